@@ -108,7 +108,7 @@ func (binaries *Binaries) parseV1From(data []byte) error {
 		return fmt.Errorf("Invalid magic")
 	}
 
-	if size < binariesFooterSize {
+	if size < binariesFooterSize || size > n {
 		return fmt.Errorf("Invalid size")
 	}
 
@@ -122,57 +122,54 @@ func (binaries *Binaries) parseV1From(data []byte) error {
 		return fmt.Errorf("Invalid checksum")
 	}
 
-	binaries.Generations = nil
+	buffer := &entriesReader{b: bytes.NewBuffer(entries)}
 
-	buffer := bytes.NewBuffer(entries)
+	count = buffer.count(count, binariesGenerationSize)
+
+	binaries.Generations = make([]Generation, count)
 
 	for i := 0; i < count; i++ {
 		var (
-			generation    = int(binary.BigEndian.Uint32(buffer.Next(4)))
-			segmentsCount = int(binary.BigEndian.Uint32(buffer.Next(4)))
+			generation    = buffer.uint32()
+			segmentsCount = buffer.count(buffer.uint32(), binariesSegmentSize)
 			segments      = make([]Segment, segmentsCount)
 		)
 
 		for i := 0; i < segmentsCount; i++ {
 			var (
-				msb             = binary.BigEndian.Uint64(buffer.Next(8))
-				lsb             = binary.BigEndian.Uint64(buffer.Next(8))
-				referencesCount = int(binary.BigEndian.Uint32(buffer.Next(4)))
+				msb             = buffer.uint64()
+				lsb             = buffer.uint64()
+				referencesCount = buffer.count(buffer.uint32(), binariesReferenceSize)
 				references      = make([]string, referencesCount)
 			)
 
 			for i := 0; i < referencesCount; i++ {
-				var (
-					size      = int(binary.BigEndian.Uint32(buffer.Next(4)))
-					reference = string(buffer.Next(size))
-				)
-
-				references[i] = reference
+				references[i] = string(buffer.next(buffer.uint32()))
 			}
 
-			segments = append(segments, Segment{
+			segments[i] = Segment{
 				Msb:        msb,
 				Lsb:        lsb,
 				References: references,
-			})
+			}
 		}
 
-		binaries.Generations = append(binaries.Generations, Generation{
+		binaries.Generations[i] = Generation{
 			Generation:     generation,
 			FullGeneration: generation,
 			Compacted:      true,
 			Segments:       segments,
-		})
+		}
 	}
 
-	return nil
+	return buffer.err
 }
 
 func (binaries *Binaries) parseV2From(data []byte) error {
 	const (
 		binariesMagic          = magicV2
 		binariesFooterSize     = 16
-		binariesGenerationSize = 8
+		binariesGenerationSize = 13
 		binariesSegmentSize    = 20
 		binariesReferenceSize  = 4
 	)
@@ -202,7 +199,7 @@ func (binaries *Binaries) parseV2From(data []byte) error {
 		return fmt.Errorf("Invalid magic")
 	}
 
-	if size < binariesFooterSize {
+	if size < binariesFooterSize || size > n {
 		return fmt.Errorf("Invalid size")
 	}
 
@@ -216,34 +213,31 @@ func (binaries *Binaries) parseV2From(data []byte) error {
 		return fmt.Errorf("Invalid checksum")
 	}
 
-	binaries.Generations = make([]Generation, count)
+	buffer := &entriesReader{b: bytes.NewBuffer(entries)}
 
-	buffer := bytes.NewBuffer(entries)
+	count = buffer.count(count, binariesGenerationSize)
+
+	binaries.Generations = make([]Generation, count)
 
 	for i := 0; i < count; i++ {
 		var (
-			generation     = int(binary.BigEndian.Uint32(buffer.Next(4)))
-			fullGeneration = int(binary.BigEndian.Uint32(buffer.Next(4)))
-			compacted      = buffer.Next(1)[0] != 0
-			segmentsCount  = int(binary.BigEndian.Uint32(buffer.Next(4)))
+			generation     = buffer.uint32()
+			fullGeneration = buffer.uint32()
+			compacted      = buffer.byte() != 0
+			segmentsCount  = buffer.count(buffer.uint32(), binariesSegmentSize)
 			segments       = make([]Segment, segmentsCount)
 		)
 
 		for i := 0; i < segmentsCount; i++ {
 			var (
-				msb             = binary.BigEndian.Uint64(buffer.Next(8))
-				lsb             = binary.BigEndian.Uint64(buffer.Next(8))
-				referencesCount = int(binary.BigEndian.Uint32(buffer.Next(4)))
+				msb             = buffer.uint64()
+				lsb             = buffer.uint64()
+				referencesCount = buffer.count(buffer.uint32(), binariesReferenceSize)
 				references      = make([]string, referencesCount)
 			)
 
 			for i := 0; i < referencesCount; i++ {
-				var (
-					size      = int(binary.BigEndian.Uint32(buffer.Next(4)))
-					reference = string(buffer.Next(size))
-				)
-
-				references[i] = reference
+				references[i] = string(buffer.next(buffer.uint32()))
 			}
 
 			segments[i] = Segment{
@@ -261,5 +255,63 @@ func (binaries *Binaries) parseV2From(data []byte) error {
 		}
 	}
 
-	return nil
+	return buffer.err
+}
+
+// entriesReader reads the fields of the entries of the binary references. The
+// first read past the end of the entries is remembered in 'err', and every
+// read after that returns zero values, so that the entries can be read without
+// checking every field.
+type entriesReader struct {
+	b   *bytes.Buffer
+	err error
+}
+
+func (r *entriesReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	data := r.b.Next(n)
+
+	if len(data) < n {
+		r.err = fmt.Errorf("not enough data")
+		return nil
+	}
+
+	return data
+}
+
+func (r *entriesReader) byte() byte {
+	if data := r.next(1); data != nil {
+		return data[0]
+	}
+	return 0
+}
+
+func (r *entriesReader) uint32() int {
+	if data := r.next(4); data != nil {
+		return int(binary.BigEndian.Uint32(data))
+	}
+	return 0
+}
+
+func (r *entriesReader) uint64() uint64 {
+	if data := r.next(8); data != nil {
+		return binary.BigEndian.Uint64(data)
+	}
+	return 0
+}
+
+// count returns 'n', the number of items of at least 'size' bytes that follow.
+// If the remaining entries are too short to contain them, 'err' is set and
+// zero is returned.
+func (r *entriesReader) count(n, size int) int {
+	if r.err == nil && n > r.b.Len()/size {
+		r.err = fmt.Errorf("invalid count %d", n)
+	}
+	if r.err != nil {
+		return 0
+	}
+	return n
 }
@@ -0,0 +1,144 @@
+package binaries
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+// testBinaries serializes the binary references of 'generations' in the format
+// identified by 'magic'.
+func testBinaries(magic uint32, generations []Generation) []byte {
+	var b bytes.Buffer
+	for _, g := range generations {
+		binary.Write(&b, binary.BigEndian, uint32(g.Generation))
+		if magic == magicV2 {
+			binary.Write(&b, binary.BigEndian, uint32(g.FullGeneration))
+			if g.Compacted {
+				b.WriteByte(1)
+			} else {
+				b.WriteByte(0)
+			}
+		}
+		binary.Write(&b, binary.BigEndian, uint32(len(g.Segments)))
+		for _, s := range g.Segments {
+			binary.Write(&b, binary.BigEndian, s.Msb)
+			binary.Write(&b, binary.BigEndian, s.Lsb)
+			binary.Write(&b, binary.BigEndian, uint32(len(s.References)))
+			for _, r := range s.References {
+				binary.Write(&b, binary.BigEndian, uint32(len(r)))
+				b.WriteString(r)
+			}
+		}
+	}
+	entries := b.Bytes()
+	footer := make([]byte, 16)
+	binary.BigEndian.PutUint32(footer[0:], crc32.ChecksumIEEE(entries))
+	binary.BigEndian.PutUint32(footer[4:], uint32(len(generations)))
+	binary.BigEndian.PutUint32(footer[8:], uint32(len(entries)+len(footer)))
+	binary.BigEndian.PutUint32(footer[12:], magic)
+	return append(entries, footer...)
+}
+
+func testGenerations() []Generation {
+	return []Generation{
+		{Generation: 1, FullGeneration: 1, Compacted: true, Segments: []Segment{
+			{Msb: 1, Lsb: 2, References: []string{"a", "bc"}},
+			{Msb: 3, Lsb: 4, References: []string{}},
+		}},
+		{Generation: 2, FullGeneration: 2, Compacted: true, Segments: []Segment{
+			{Msb: 5, Lsb: 6, References: []string{"def"}},
+		}},
+	}
+}
+
+func TestRead(t *testing.T) {
+	for _, magic := range []uint32{magicV1, magicV2} {
+		var b Binaries
+		if _, err := b.ReadFrom(bytes.NewReader(testBinaries(magic, testGenerations()))); err != nil {
+			t.Fatalf("%08x: %v", magic, err)
+		}
+		if !reflect.DeepEqual(b.Generations, testGenerations()) {
+			t.Fatalf("%08x: got %+v, want %+v", magic, b.Generations, testGenerations())
+		}
+	}
+}
+
+// withCount replaces the count of generations in the footer of 'data'.
+func withCount(data []byte, count uint32) []byte {
+	n := len(data)
+	binary.BigEndian.PutUint32(data[n-12:], count)
+	return data
+}
+
+// withChecksum recomputes the checksum of 'data', so that corrupted entries are
+// parsed.
+func withChecksum(data []byte) []byte {
+	n := len(data)
+	size := int(binary.BigEndian.Uint32(data[n-8:]))
+	binary.BigEndian.PutUint32(data[n-16:], crc32.ChecksumIEEE(data[n-size:n-16]))
+	return data
+}
+
+func TestReadCorrupted(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(data []byte) []byte
+	}{
+		{
+			name: "size larger than data",
+			modify: func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[len(data)-8:], uint32(len(data)+1))
+				return data
+			},
+		},
+		{
+			name: "size smaller than footer",
+			modify: func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[len(data)-8:], 15)
+				return data
+			},
+		},
+		{
+			name: "count larger than entries",
+			modify: func(data []byte) []byte {
+				return withCount(data, 3)
+			},
+		},
+		{
+			name: "huge count",
+			modify: func(data []byte) []byte {
+				return withCount(data, 0xffffffff)
+			},
+		},
+		{
+			name: "huge reference length",
+			modify: func(data []byte) []byte {
+				i := bytes.Index(data, []byte("\x00\x00\x00\x01a"))
+				binary.BigEndian.PutUint32(data[i:], 0x7fffffff)
+				return withChecksum(data)
+			},
+		},
+		{
+			name: "truncated entries",
+			modify: func(data []byte) []byte {
+				n := len(data)
+				data = append(data[:n-17], data[n-16:]...)
+				binary.BigEndian.PutUint32(data[len(data)-8:], binary.BigEndian.Uint32(data[len(data)-8:])-1)
+				return withChecksum(data)
+			},
+		},
+	}
+	for _, magic := range []uint32{magicV1, magicV2} {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				var b Binaries
+				if _, err := b.ReadFrom(bytes.NewReader(test.modify(testBinaries(magic, testGenerations())))); err == nil {
+					t.Fatalf("%08x: expected an error", magic)
+				}
+			})
+		}
+	}
+}
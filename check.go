@@ -0,0 +1,245 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/francescomari/sdb/binaries"
+	"github.com/francescomari/sdb/graph"
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
+	"github.com/francescomari/sdb/segment"
+)
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type tarEntry struct {
+	name   string
+	offset int64
+	size   int64
+}
+
+type checker struct {
+	w        io.Writer
+	problems int
+}
+
+func (c *checker) report(name string, offset int64, format string, args ...interface{}) {
+	c.problems++
+	fmt.Fprintf(c.w, "%s %x %s\n", name, offset, fmt.Sprintf(format, args...))
+}
+
+// checkTarFile verifies the structure of a TAR file and the consistency between
+// its segments, index and graph. Every problem is printed to 'w' on its own
+// line, with the segment IDs in notation 'nt'. It returns the number of
+// problems found. If 'fast' is true, the content of the segments is not parsed.
+func checkTarFile(p string, fast bool, nt inspect.Notation, w io.Writer) (int, error) {
+	f, err := openTarFile(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var (
+		c        = checker{w: w}
+		cr       = &countingReader{r: f}
+		r        = tar.NewReader(cr)
+		segments = make(map[string]tarEntry)
+		idxEntry tarEntry
+		gphEntry tarEntry
+		idx      *index.Index
+		gph      *graph.Graph
+	)
+
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.report(p, cr.n, "invalid TAR structure: %v", err)
+			break
+		}
+		e := tarEntry{hdr.Name, cr.n, hdr.Size}
+		switch {
+		case isAnySegment(hdr.Name):
+			id := inspect.EntrySegmentID(hdr.Name)
+			segments[id] = e
+			if fast || inspect.IsBulkSegmentID(id) {
+				continue
+			}
+			var s segment.Segment
+			if _, err := s.ReadFrom(r); err != nil {
+				c.report(e.name, e.offset, "invalid segment: %v", err)
+			}
+		case isIndex(hdr.Name):
+			idxEntry = e
+			idx = new(index.Index)
+			if _, err := idx.ReadFrom(r); err != nil {
+				c.report(e.name, e.offset, "invalid index: %v", err)
+				idx = nil
+			}
+		case isGraph(hdr.Name):
+			gphEntry = e
+			gph = new(graph.Graph)
+			if _, err := gph.ReadFrom(r); err != nil {
+				c.report(e.name, e.offset, "invalid graph: %v", err)
+				gph = nil
+			}
+		case isBinary(hdr.Name):
+			var bns binaries.Binaries
+			if _, err := bns.ReadFrom(r); err != nil {
+				c.report(e.name, e.offset, "invalid binary references index: %v", err)
+			}
+		}
+	}
+
+	indexed := make(map[string]bool)
+
+	if idx != nil {
+		for _, ie := range idx.Entries {
+			id := inspect.SegmentID(ie.Msb, ie.Lsb)
+			indexed[id] = true
+			se, ok := segments[id]
+			if !ok {
+				c.report(idxEntry.name, idxEntry.offset, "segment %s not found", nt.ID(id))
+				continue
+			}
+			if se.size != int64(ie.Size) {
+				c.report(se.name, se.offset, "size %d doesn't match the indexed size %d", se.size, ie.Size)
+			}
+			if se.offset != int64(ie.Position) {
+				c.report(se.name, se.offset, "offset doesn't match the indexed position %s", nt.Hex(ie.Position))
+			}
+		}
+	}
+
+	if idx != nil && gph != nil {
+		for _, ge := range gph.Entries {
+			for _, gr := range ge.References {
+				if id := inspect.SegmentID(gr.Msb, gr.Lsb); !indexed[id] {
+					c.report(gphEntry.name, gphEntry.offset, "segment %s referenced by %s not found in the index", nt.ID(id), nt.SegmentID(ge.Msb, ge.Lsb))
+				}
+			}
+		}
+	}
+
+	return c.problems, nil
+}
+
+func isIndexOrGraph(n string) bool {
+	return isIndex(n) || isGraph(n)
+}
+
+// doVerifyIndexGraph returns a handler collecting the index and the graph of a
+// TAR file, and a function printing the segments in the index without an entry
+// in the graph, and vice versa. The function returns an error if the index and
+// the graph are inconsistent.
+func doVerifyIndexGraph(nt inspect.Notation, w io.Writer) (handler, func() error) {
+	var (
+		idx *index.Index
+		gph *graph.Graph
+	)
+	h := requiring(func(n string, r io.Reader) error {
+		if isIndex(n) {
+			var i index.Index
+			if _, err := inspect.Parse(i.ReadFrom, r); err != nil {
+				return err
+			}
+			idx = &i
+			return nil
+		}
+		var g graph.Graph
+		if _, err := inspect.Parse(g.ReadFrom, r); err != nil {
+			return err
+		}
+		gph = &g
+		return nil
+	})
+	verify := func() error {
+		if idx == nil {
+			return fmt.Errorf("index not found")
+		}
+		if gph == nil {
+			return fmt.Errorf("graph not found")
+		}
+		var (
+			inGraph        = make(map[string]bool)
+			missingInGraph []string
+			missingInIndex []string
+		)
+		for _, e := range gph.Entries {
+			id := inspect.SegmentID(e.Msb, e.Lsb)
+			inGraph[id] = true
+			if _, ok := idx.Lookup(e.Msb, e.Lsb); !ok {
+				missingInIndex = append(missingInIndex, id)
+			}
+		}
+		for _, e := range idx.Entries {
+			if id := inspect.SegmentID(e.Msb, e.Lsb); !inGraph[id] {
+				missingInGraph = append(missingInGraph, id)
+			}
+		}
+		if len(missingInGraph) > 0 {
+			fmt.Fprintln(w, "missing from graph")
+			for _, id := range missingInGraph {
+				fmt.Fprintln(w, nt.ID(id))
+			}
+		}
+		if len(missingInIndex) > 0 {
+			fmt.Fprintln(w, "missing from index")
+			for _, id := range missingInIndex {
+				fmt.Fprintln(w, nt.ID(id))
+			}
+		}
+		if n := len(missingInGraph) + len(missingInIndex); n > 0 {
+			return verificationFailed("found %d inconsistencies", n)
+		}
+		return nil
+	}
+	return h, verify
+}
+
+// doCheckIndexOverlap returns a handler verifying that the byte ranges of the
+// entries of an index don't overlap. Every pair of overlapping entries is
+// printed on its own line, with the ID, the position and the size of the first
+// entry and the ID and the position of the second one. The handler returns an
+// error if any pair of entries overlaps.
+func doCheckIndexOverlap(nt inspect.Notation, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var idx index.Index
+		if _, err := inspect.Parse(idx.ReadFrom, r); err != nil {
+			return err
+		}
+		es := make([]index.Entry, len(idx.Entries))
+		copy(es, idx.Entries)
+		sort.SliceStable(es, func(i, j int) bool {
+			return es[i].Position < es[j].Position
+		})
+		overlaps := 0
+		for i, a := range es {
+			for _, b := range es[i+1:] {
+				if b.Position >= a.Position+a.Size {
+					break
+				}
+				fmt.Fprintf(w, "%s %s %d overlaps %s %s\n", nt.SegmentID(a.Msb, a.Lsb), nt.Hex(a.Position), a.Size, nt.SegmentID(b.Msb, b.Lsb), nt.Hex(b.Position))
+				overlaps++
+			}
+		}
+		if overlaps > 0 {
+			return verificationFailed("found %d overlaps", overlaps)
+		}
+		return nil
+	}
+}
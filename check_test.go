@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/francescomari/sdb/inspect"
+)
+
+func TestVerifyIndexGraph(t *testing.T) {
+	var (
+		segments = testStore()
+		a, b, c  = segments[0], segments[1], segments[2]
+	)
+	tests := []struct {
+		name    string
+		index   []testSegment
+		graph   []testSegment
+		want    string
+		wantErr bool
+	}{
+		{"matching", []testSegment{a, b}, []testSegment{a, b}, "", false},
+		{"index only", []testSegment{a, b, c}, []testSegment{a, b}, "missing from graph\n" + testC.String() + "\n", true},
+		{"graph only", []testSegment{a}, []testSegment{a, b}, "missing from index\n" + testB.String() + "\n", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				p = writeTestTar(t, "data00000a.tar",
+					testIndex("data00000a.tar", test.index...),
+					testGraph("data00000a.tar", test.graph...),
+				)
+				out bytes.Buffer
+			)
+			h, verify := doVerifyIndexGraph(inspect.Notation{}, &out)
+			if err := forEachMatchingEntry(p, isIndexOrGraph, h); err != nil {
+				t.Fatal(err)
+			}
+			err := verify()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if err != nil && exitCode(err) != exitVerificationError {
+				t.Fatalf("got exit code %d, want %d", exitCode(err), exitVerificationError)
+			}
+			if out.String() != test.want {
+				t.Fatalf("got %q, want %q", out.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/francescomari/sdb/inspect"
+	"github.com/spf13/cobra"
+)
+
+// colorMode controls when the text output is colored.
+type colorMode string
+
+const (
+	colorAuto   colorMode = "auto"
+	colorAlways colorMode = "always"
+	colorNever  colorMode = "never"
+)
+
+func (c *colorMode) String() string {
+	return string(*c)
+}
+
+func (c *colorMode) Set(s string) error {
+	switch colorMode(s) {
+	case colorAuto:
+		*c = colorAuto
+	case colorAlways:
+		*c = colorAlways
+	case colorNever:
+		*c = colorNever
+	default:
+		return fmt.Errorf("Invalid color mode '%s'", s)
+	}
+	return nil
+}
+
+func (c *colorMode) Type() string {
+	return "mode"
+}
+
+// withColor returns a palette for the output written to 'f', as requested by
+// the --color flag. In auto mode, the output is colored only if 'f' is a
+// terminal and the NO_COLOR environment variable is not set to a non-empty
+// value.
+func withColor(cmd *cobra.Command, f *os.File) inspect.Palette {
+	switch colorMode(cmd.Flags().Lookup("color").Value.String()) {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	default:
+		return inspect.Palette(isTerminal(f) && os.Getenv("NO_COLOR") == "")
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
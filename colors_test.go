@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/francescomari/sdb/inspect"
+	"github.com/spf13/cobra"
+)
+
+func TestWithColor(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tests := []struct {
+		args    []string
+		noColor string
+		want    inspect.Palette
+	}{
+		{nil, "", false},
+		{[]string{"--color", "auto"}, "", false},
+		{[]string{"--color", "never"}, "", false},
+		{[]string{"--color", "always"}, "", true},
+		{[]string{"--color", "always"}, "1", true},
+		{[]string{"--color", "auto"}, "1", false},
+	}
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	for _, test := range tests {
+		os.Setenv("NO_COLOR", test.noColor)
+		var (
+			cmd   = &cobra.Command{}
+			color = colorAuto
+		)
+		cmd.Flags().Var(&color, "color", "")
+		if err := cmd.ParseFlags(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if got := withColor(cmd, f); got != test.want {
+			t.Fatalf("%v, NO_COLOR=%q: got %v, want %v", test.args, test.noColor, got, test.want)
+		}
+	}
+}
+
+func TestInvalidColorMode(t *testing.T) {
+	var c colorMode
+	if err := c.Set("sometimes"); err == nil {
+		t.Fatal("an invalid color mode was accepted")
+	}
+}
+
+func TestPlainOutputHasNoEscapes(t *testing.T) {
+	var (
+		segments = testStore()
+		idx      = testIndex("data00000a.tar", segments...)
+		seg      = segments[0].entry()
+	)
+	printText := func(color inspect.Palette) string {
+		var b bytes.Buffer
+		inspect.PrintIndex(inspect.FormatText, inspect.IndexView{Keep: inspect.AllOf(), Page: inspect.AllEntries(), Color: color}, &b)(idx.name, bytes.NewReader(idx.data))
+		inspect.PrintSegment(inspect.FormatText, inspect.SegmentView{Keep: inspect.AnyRecord, Color: color}, &b)(seg.name, bytes.NewReader(seg.data))
+		return b.String()
+	}
+	plain, colored := printText(false), printText(true)
+	if strings.Contains(plain, "\x1b") {
+		t.Fatalf("escape sequences in plain output %q", plain)
+	}
+	if !strings.Contains(colored, "\x1b") {
+		t.Fatalf("no escape sequences in colored output %q", colored)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
+)
+
+// segmentSummary describes a segment in a TAR file. The position and the
+// generation are negative if they are unknown.
+type segmentSummary struct {
+	size       int
+	position   int
+	generation int
+}
+
+func isIndexOrSegment(n string) bool {
+	return isIndex(n) || isAnySegment(n)
+}
+
+// readSegmentSummaries returns a description of every segment in a TAR file,
+// indexed by segment ID. The description is read from the index. If the TAR
+// file doesn't have an index, the sizes of the segment entries are used
+// instead, and the positions and generations are unknown.
+func readSegmentSummaries(p string) (map[string]segmentSummary, error) {
+	var (
+		idx     *index.Index
+		entries = make(map[string]segmentSummary)
+	)
+	err := forEachMatchingEntryHeader(p, isIndexOrSegment, func(hdr *tar.Header, r io.Reader) error {
+		n := hdr.Name
+		if isIndex(n) {
+			return requiring(func(_ string, r io.Reader) error {
+				var i index.Index
+				if _, err := inspect.Parse(i.ReadFrom, r); err != nil {
+					return err
+				}
+				idx = &i
+				return nil
+			})(n, r)
+		}
+		entries[inspect.EntrySegmentID(n)] = segmentSummary{int(hdr.Size), -1, -1}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		return entries, nil
+	}
+	indexed := make(map[string]segmentSummary)
+	for _, e := range idx.Entries {
+		indexed[inspect.SegmentID(e.Msb, e.Lsb)] = segmentSummary{e.Size, e.Position, e.Generation}
+	}
+	return indexed, nil
+}
+
+// change is a property of a segment whose value differs between two TAR files.
+type change struct {
+	Property string `json:"property"`
+	Old      int    `json:"old"`
+	New      int    `json:"new"`
+}
+
+// changesTo returns the properties that differ between 's' and 'o'. Unknown
+// positions and generations are not compared.
+func (s segmentSummary) changesTo(o segmentSummary) []change {
+	var changes []change
+	if s.size != o.size {
+		changes = append(changes, change{"size", s.size, o.size})
+	}
+	if s.position >= 0 && o.position >= 0 && s.position != o.position {
+		changes = append(changes, change{"position", s.position, o.position})
+	}
+	if s.generation >= 0 && o.generation >= 0 && s.generation != o.generation {
+		changes = append(changes, change{"generation", s.generation, o.generation})
+	}
+	return changes
+}
+
+// segmentDiff is a segment that was removed, added or changed between two TAR
+// files. Only changed segments have a list of changes.
+type segmentDiff struct {
+	Kind    string   `json:"kind"`
+	ID      string   `json:"id"`
+	Changes []change `json:"changes,omitempty"`
+}
+
+// diffKinds are the kinds of differences, in the order they are printed.
+var diffKinds = []string{"removed", "added", "changed"}
+
+var diffPrefixes = map[string]string{
+	"removed": "-",
+	"added":   "+",
+	"changed": "~",
+}
+
+// diffSegments compares the segments of two TAR files. The differences are
+// grouped by kind, in the order of diffKinds, and sorted by segment ID within
+// every group.
+func diffSegments(a, b string) ([]segmentDiff, error) {
+	as, err := readSegmentSummaries(a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", a, err)
+	}
+	bs, err := readSegmentSummaries(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b, err)
+	}
+
+	var ids []string
+	for id := range as {
+		ids = append(ids, id)
+	}
+	for id := range bs {
+		if _, ok := as[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	groups := make(map[string][]segmentDiff)
+
+	for _, id := range ids {
+		ae, inA := as[id]
+		be, inB := bs[id]
+		switch {
+		case !inB:
+			groups["removed"] = append(groups["removed"], segmentDiff{Kind: "removed", ID: id})
+		case !inA:
+			groups["added"] = append(groups["added"], segmentDiff{Kind: "added", ID: id})
+		default:
+			if changes := ae.changesTo(be); len(changes) > 0 {
+				groups["changed"] = append(groups["changed"], segmentDiff{Kind: "changed", ID: id, Changes: changes})
+			}
+		}
+	}
+
+	diffs := []segmentDiff{}
+
+	for _, kind := range diffKinds {
+		diffs = append(diffs, groups[kind]...)
+	}
+
+	return diffs, nil
+}
+
+// diffTarFiles prints the differences between the segments of two TAR files,
+// as returned by diffSegments. In text format, segments only in the first file
+// are prefixed by '-', segments only in the second file by '+', and segments
+// with a different size, position or generation by '~', followed by the old
+// and new values of the changed properties. Segment IDs are printed in notation
+// 'nt' in text format. It returns true if there are differences.
+func diffTarFiles(f inspect.Format, a, b string, nt inspect.Notation, w io.Writer) (bool, error) {
+	switch f {
+	case inspect.FormatText, inspect.FormatJSON:
+	default:
+		return false, inspect.ErrInvalidFormat
+	}
+
+	diffs, err := diffSegments(a, b)
+	if err != nil {
+		return false, err
+	}
+
+	if f == inspect.FormatJSON {
+		return len(diffs) > 0, json.NewEncoder(w).Encode(diffs)
+	}
+
+	counts := make(map[string]int)
+
+	for _, d := range diffs {
+		counts[d.Kind]++
+		fmt.Fprintf(w, "%s %s", diffPrefixes[d.Kind], nt.ID(d.ID))
+		for _, c := range d.Changes {
+			fmt.Fprintf(w, " %s %d->%d", c.Property, c.Old, c.New)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "%d removed, %d added, %d changed\n", counts["removed"], counts["added"], counts["changed"])
+
+	return len(diffs) > 0, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/francescomari/sdb/inspect"
+)
+
+func TestReadSegmentSummariesWithoutIndex(t *testing.T) {
+	var (
+		segments = testStore()
+		a        = segments[0].entry()
+		c        = compressed(segments[2].entry())
+		p        = writeTestTar(t, "data00000a.tar", a, c)
+	)
+	got, err := readSegmentSummaries(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]segmentSummary{
+		testA.String(): {len(a.data), -1, -1},
+		testC.String(): {len(c.data), -1, -1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDiffCorruptedIndexIsParseError(t *testing.T) {
+	var (
+		segments = testStore()
+		a        = writeTestTar(t, "data00000a.tar", segments[0].entry(), testIndex("data00000a.tar", segments[0]))
+		b        = writeTestTar(t, "data00000b.tar", segments[0].entry(), corrupt(testIndex("data00000b.tar", segments[0])))
+	)
+	withPolicy(t, false, func() {
+		_, err := diffTarFiles(inspect.FormatText, a, b, inspect.Notation{}, ioutil.Discard)
+		if got := exitCode(err); got != exitParseError {
+			t.Fatalf("got exit code %d for %v, want %d", got, err, exitParseError)
+		}
+	})
+}
+
+func TestDiffTarFiles(t *testing.T) {
+	var (
+		segments = testStore()
+		a, b     = segments[0], segments[1]
+		newer    = a
+	)
+	newer.generation = 5
+	tests := []struct {
+		name       string
+		old, new   []testSegment
+		want       string
+		wantDiffer bool
+	}{
+		{"identical", []testSegment{a, b}, []testSegment{a, b}, "0 removed, 0 added, 0 changed\n", false},
+		{"added", []testSegment{a}, []testSegment{a, b}, "+ " + testB.String() + "\n0 removed, 1 added, 0 changed\n", true},
+		{"removed", []testSegment{a, b}, []testSegment{a}, "- " + testB.String() + "\n1 removed, 0 added, 0 changed\n", true},
+		{"changed", []testSegment{a, b}, []testSegment{newer, b}, "~ " + testA.String() + " generation 1->5\n0 removed, 0 added, 1 changed\n", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var entries [2][]testEntry
+			for i, ss := range [][]testSegment{test.old, test.new} {
+				for _, s := range ss {
+					entries[i] = append(entries[i], s.entry())
+				}
+				entries[i] = append(entries[i], testIndex("data00000a.tar", ss...))
+			}
+			var (
+				old = writeTestTar(t, "data00000a.tar", entries[0]...)
+				new = writeTestTar(t, "data00000a.tar", entries[1]...)
+				out bytes.Buffer
+			)
+			differ, err := diffTarFiles(inspect.FormatText, old, new, inspect.Notation{}, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if differ != test.wantDiffer {
+				t.Fatalf("got differ %v, want %v", differ, test.wantDiffer)
+			}
+			if out.String() != test.want {
+				t.Fatalf("got %q, want %q", out.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/francescomari/sdb/inspect"
+)
+
+// doDumpTo returns a handler printing every entry of a TAR file with the
+// handler appropriate to its name. The output for every entry is preceded by a
+// line with the name of the entry. The content of bulk segments and of unknown
+// entries is not printed. IDs are printed in the notation 'nt' and, where the
+// output supports it, with the palette 'color'.
+func doDumpTo(nt inspect.Notation, color inspect.Palette, w io.Writer) handler {
+	var (
+		printIndex    = inspect.PrintIndexTo(inspect.IndexView{Keep: inspect.AllOf(), Page: inspect.AllEntries(), Color: color, Notation: nt}, w)
+		printGraph    = inspect.PrintGraphTo(inspect.AnyID, inspect.AllEntries(), nt, w)
+		printBinaries = inspect.PrintBinariesTo(inspect.BinariesView{Page: inspect.AllEntries(), Color: color, Notation: nt}, w)
+		printSegment  = inspect.PrintSegmentTo(inspect.SegmentView{Keep: inspect.AnyRecord, Color: color, Notation: nt}, w)
+	)
+	return func(n string, r io.Reader) error {
+		fmt.Fprintf(w, "--- %s\n", n)
+		switch {
+		case isIndex(n):
+			return printIndex(n, r)
+		case isGraph(n):
+			return printGraph(n, r)
+		case isBinary(n):
+			return printBinaries(n, r)
+		case isAnySegment(n) && !inspect.IsBulkSegmentID(inspect.EntrySegmentID(n)):
+			return printSegment(n, r)
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/francescomari/sdb/inspect"
+	"github.com/francescomari/sdb/segment"
+)
+
+// testManySegments returns 'n' data segments, each with a value record and a
+// reference to the previous one.
+func testManySegments(n int) []testSegment {
+	var segments []testSegment
+	for i := 0; i < n; i++ {
+		s := testSegment{
+			id:         testID{0x6666666666664000 | uint64(i), 0xa666666666666666},
+			generation: i,
+			records: []testRecord{
+				{0, segment.RecordTypeValue, []byte(fmt.Sprintf("\x08value%03d", i))},
+			},
+		}
+		if i > 0 {
+			s.references = []testID{segments[i-1].id}
+		}
+		segments = append(segments, s)
+	}
+	return segments
+}
+
+func TestDumpJobs(t *testing.T) {
+	var (
+		segments = append(testStore(), testManySegments(32)...)
+		entries  []testEntry
+	)
+	for _, s := range segments {
+		entries = append(entries, s.entry())
+	}
+	entries = append(entries, testGraph("data00000a.tar", segments...), testIndex("data00000a.tar", segments...))
+	tests := []struct {
+		name    string
+		entries []testEntry
+	}{
+		{"valid", entries},
+		{"corrupted", append(entries[:len(entries)-1:len(entries)-1], corrupt(entries[len(entries)-1]))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := writeTestTar(t, "data00000a.tar", test.entries...)
+			dump := func(jobs int) (string, string) {
+				var b bytes.Buffer
+				warnings := withPolicy(t, false, func() {
+					if err := forEachMatchingEntryConcurrently(p, any, jobs, func(w io.Writer) handler {
+						return doDumpTo(inspect.Notation{}, false, w)
+					}, &b); err != nil {
+						t.Fatal(err)
+					}
+				})
+				return b.String(), warnings
+			}
+			want, wantWarnings := dump(1)
+			if !strings.Contains(want, "--- "+segments[len(segments)-1].entry().name) {
+				t.Fatalf("the last segment was not dumped:\n%s", want)
+			}
+			for _, jobs := range []int{2, 4, 8} {
+				got, gotWarnings := dump(jobs)
+				if got != want {
+					t.Fatalf("jobs %d: got\n%s\nwant\n%s", jobs, got, want)
+				}
+				if gotWarnings != wantWarnings {
+					t.Fatalf("jobs %d: got warnings %q, want %q", jobs, gotWarnings, wantWarnings)
+				}
+			}
+		})
+	}
+}
+
+func TestDumpJobsStrict(t *testing.T) {
+	var (
+		segments = testManySegments(64)
+		entries  []testEntry
+	)
+	for _, s := range segments {
+		entries = append(entries, s.entry())
+	}
+	const failing = 8
+	bad := entries[failing]
+	entries[failing] = testEntry{bad.name, append([]byte("bad"), bad.data[3:]...)}
+	p := writeTestTar(t, "data00000a.tar", entries...)
+	dump := func(jobs int) (string, int32) {
+		var (
+			b       bytes.Buffer
+			handled int32
+		)
+		withPolicy(t, true, func() {
+			err := forEachMatchingEntryConcurrently(p, any, jobs, func(w io.Writer) handler {
+				atomic.AddInt32(&handled, 1)
+				return doDumpTo(inspect.Notation{}, false, w)
+			}, &b)
+			if err == nil {
+				t.Fatalf("jobs %d: no error for the corrupted entry", jobs)
+			}
+		})
+		return b.String(), atomic.LoadInt32(&handled)
+	}
+	want, _ := dump(1)
+	for _, jobs := range []int{2, 4, 8} {
+		got, handled := dump(jobs)
+		if got != want {
+			t.Fatalf("jobs %d: got\n%s\nwant\n%s", jobs, got, want)
+		}
+		// Besides the entry being flushed, at most 'jobs' entries are queued
+		// and one more is read while the error is reported.
+		if max := int32(failing + jobs + 3); handled > max {
+			t.Fatalf("jobs %d: %d entries handled, want at most %d", jobs, handled, max)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	const p = "testdata/data00000a.tar"
+	var b bytes.Buffer
+	if err := forEachMatchingEntry(p, any, doDumpTo(inspect.Notation{}, false, &b)); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(p + ".dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != string(want) {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestDumpNotation(t *testing.T) {
+	const p = "testdata/data00000a.tar"
+	var b bytes.Buffer
+	if err := forEachMatchingEntry(p, any, doDumpTo(inspect.Notation{Dashed: true}, false, &b)); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"11111111-1111-4111-a111-111111111111", "22222222-2222-4222-b222-222222222222"} {
+		if !strings.Contains(b.String(), id) {
+			t.Fatalf("%s not found in\n%s", id, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "1111111111114111a111111111111111") {
+		t.Fatalf("undashed ID found in\n%s", b.String())
+	}
+}
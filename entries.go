@@ -0,0 +1,63 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/francescomari/sdb/inspect"
+)
+
+type tarEntrySummary struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Kind string `json:"kind"`
+}
+
+// entryKind classifies an entry of a TAR file by its name.
+func entryKind(n string) string {
+	switch {
+	case isAnySegment(n):
+		return "segment"
+	case isIndex(n):
+		return "index"
+	case isGraph(n):
+		return "graph"
+	case isBinary(n):
+		return "binaries"
+	default:
+		return "unknown"
+	}
+}
+
+// doListEntries returns a handler collecting the name, the size and the kind
+// of every entry of a TAR file, without reading its content, and a function
+// printing them followed by the total number and size of the entries. The
+// format must be either text or JSON.
+func doListEntries(f inspect.Format, w io.Writer) (entryHandler, func() error) {
+	es := []tarEntrySummary{}
+	h := func(hdr *tar.Header, _ io.Reader) error {
+		es = append(es, tarEntrySummary{hdr.Name, hdr.Size, entryKind(hdr.Name)})
+		return nil
+	}
+	print := func() error {
+		var total int64
+		for _, e := range es {
+			total += e.Size
+		}
+		if f == inspect.FormatJSON {
+			return json.NewEncoder(w).Encode(struct {
+				Entries []tarEntrySummary `json:"entries"`
+				Count   int               `json:"count"`
+				Size    int64             `json:"size"`
+			}{es, len(es), total})
+		}
+		for _, e := range es {
+			fmt.Fprintf(w, "%s %d %s\n", e.Kind, e.Size, e.Name)
+		}
+		fmt.Fprintf(w, "%d entries, %d bytes\n", len(es), total)
+		return nil
+	}
+	return h, print
+}
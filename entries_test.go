@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/francescomari/sdb/inspect"
+)
+
+func TestListEntries(t *testing.T) {
+	var (
+		segments = testStore()
+		a        = segments[0].entry()
+		idx      = compressed(testIndex("data00000a.tar", segments...))
+		unknown  = testEntry{"unknown", []byte("data")}
+		p        = writeTestTar(t, "data00000a.tar", a, idx, unknown)
+	)
+	tests := []struct {
+		format inspect.Format
+		want   string
+	}{
+		{
+			inspect.FormatText,
+			fmt.Sprintf("segment %d %s\nindex %d %s\nunknown 4 unknown\n3 entries, %d bytes\n",
+				len(a.data), a.name, len(idx.data), idx.name, len(a.data)+len(idx.data)+4),
+		},
+		{
+			inspect.FormatJSON,
+			fmt.Sprintf(`{"entries":[{"name":"%s","size":%d,"kind":"segment"},{"name":"%s","size":%d,"kind":"index"},{"name":"unknown","size":4,"kind":"unknown"}],"count":3,"size":%d}`+"\n",
+				a.name, len(a.data), idx.name, len(idx.data), len(a.data)+len(idx.data)+4),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.format.String(), func(t *testing.T) {
+			var b bytes.Buffer
+			h, print := doListEntries(test.format, &b)
+			withPolicy(t, false, func() {
+				if err := forEachMatchingEntryHeader(p, any, h); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if err := print(); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != test.want {
+				t.Fatalf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/francescomari/sdb/inspect"
+)
+
+// The exit codes of the commands. A command exits with exitInvalidFormat if the
+// requested output format is not supported, with exitParseError if a TAR file
+// or one of its entries is corrupted, and with exitVerificationError if a
+// verification finds problems in a TAR file. Any other failure, like a missing
+// file or an invalid argument, makes the command exit with exitFailure. The
+// diff command exits with exitDifferences if the TAR files differ, which is not
+// a failure.
+const (
+	exitSuccess           = 0
+	exitFailure           = 1
+	exitInvalidFormat     = 2
+	exitParseError        = 3
+	exitVerificationError = 4
+	exitDifferences       = 5
+)
+
+// verificationError is returned when a verification finds problems in a TAR
+// file.
+type verificationError struct {
+	msg string
+}
+
+func (e *verificationError) Error() string {
+	return e.msg
+}
+
+func verificationFailed(format string, args ...interface{}) error {
+	return &verificationError{fmt.Sprintf(format, args...)}
+}
+
+// exitCode returns the exit code corresponding to 'err'.
+func exitCode(err error) int {
+	var (
+		parseErr        *inspect.ParseError
+		verificationErr *verificationError
+	)
+	switch {
+	case err == nil:
+		return exitSuccess
+	case errors.Is(err, inspect.ErrInvalidFormat):
+		return exitInvalidFormat
+	case errors.As(err, &parseErr):
+		return exitParseError
+	case errors.As(err, &verificationErr):
+		return exitVerificationError
+	default:
+		return exitFailure
+	}
+}
+
+// exitStatus is the exit code of the first failure of a command processing
+// several TAR files.
+type exitStatus int
+
+func (s *exitStatus) fail(err error) {
+	if *s == exitSuccess {
+		*s = exitStatus(exitCode(err))
+	}
+}
+
+// exit discards the output of a failed command and exits with 'code'. It must
+// be used instead of os.Exit once the command is running. A command that
+// would otherwise succeed exits with exitParseError if it skipped entries that
+// couldn't be parsed.
+func exit(code int) {
+	if code == exitSuccess && entryPolicy.skippedEntries() > 0 {
+		code = exitParseError
+	}
+	discardOutput()
+	os.Exit(code)
+}
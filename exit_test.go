@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/francescomari/sdb/inspect"
+)
+
+func TestExitCode(t *testing.T) {
+	parseErr := &inspect.ParseError{Err: errors.New("Invalid magic")}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitSuccess},
+		{"failure", errors.New("no such file"), exitFailure},
+		{"invalid format", inspect.ErrInvalidFormat, exitInvalidFormat},
+		{"wrapped invalid format", fmt.Errorf("data00000a.tar: %w", inspect.ErrInvalidFormat), exitInvalidFormat},
+		{"parse error", parseErr, exitParseError},
+		{"wrapped parse error", fmt.Errorf("data00000a.tar.gph: offset 10: %w", parseErr), exitParseError},
+		{"required entry", &requiredEntryError{parseErr}, exitParseError},
+		{"verification", verificationFailed("%d problems found", 2), exitVerificationError},
+		{"wrapped verification", fmt.Errorf("data00000a.tar: %w", verificationFailed("problems")), exitVerificationError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := exitCode(test.err); got != test.want {
+				t.Fatalf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExitCodesAreDistinct(t *testing.T) {
+	codes := []int{exitSuccess, exitFailure, exitInvalidFormat, exitParseError, exitVerificationError, exitDifferences}
+	seen := make(map[int]bool)
+	for _, c := range codes {
+		if seen[c] {
+			t.Fatalf("exit code %d is used twice", c)
+		}
+		seen[c] = true
+	}
+}
+
+func TestExitStatusKeepsFirstFailure(t *testing.T) {
+	var s exitStatus
+	s.fail(&inspect.ParseError{Err: errors.New("Invalid checksum")})
+	s.fail(verificationFailed("problems"))
+	if s != exitParseError {
+		t.Fatalf("got %d, want %d", s, exitParseError)
+	}
+}
+
+// TestCommandExitCode runs the commands in a child process, because they exit
+// the process when they fail.
+func TestCommandExitCode(t *testing.T) {
+	if args := os.Getenv("SDB_TEST_ARGS"); args != "" {
+		cmd := newRootCommand()
+		cmd.SetArgs(strings.Fields(args))
+		if err := cmd.Execute(); err != nil {
+			exit(exitFailure)
+		}
+		exit(exitSuccess)
+	}
+	tests := []struct {
+		name string
+		args string
+		want int
+	}{
+		{"entries", "entries testdata/data00000a.tar", exitSuccess},
+		{"entries invalid format", "entries --format dot testdata/data00000a.tar", exitInvalidFormat},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestCommandExitCode$")
+			cmd.Env = append(os.Environ(), "SDB_TEST_ARGS="+test.args)
+			err := cmd.Run()
+			got := 0
+			if e, ok := err.(*exec.ExitError); ok {
+				got = e.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
+)
+
+// generations is an inclusive range of generations. A negative max means that
+// the range is unbounded.
+type generations struct {
+	min int
+	max int
+}
+
+func anyGeneration() generations {
+	return generations{0, -1}
+}
+
+func exactGeneration(n int) generations {
+	return generations{n, n}
+}
+
+func (g generations) isAny() bool {
+	return g.min <= 0 && g.max < 0
+}
+
+func (g generations) contains(n int) bool {
+	return n >= g.min && (g.max < 0 || n <= g.max)
+}
+
+func (g generations) indexFilter() inspect.IndexFilter {
+	return func(e index.Entry) bool {
+		return g.contains(e.Generation)
+	}
+}
+
+var segmentIDPrefixRegexp = regexp.MustCompile("^[0-9a-f]{1,32}$")
+
+// segmentIDPrefixesFilter returns a filter accepting the segment IDs starting
+// with any of the provided prefixes. The prefixes are normalized like segment
+// IDs. If no prefix is provided, every segment ID is accepted.
+func segmentIDPrefixesFilter(prefixes []string) (inspect.IDFilter, error) {
+	if len(prefixes) == 0 {
+		return inspect.AnyID, nil
+	}
+	var normalized []string
+	for _, p := range prefixes {
+		n := inspect.NormalizeSegmentID(p)
+		if !segmentIDPrefixRegexp.MatchString(n) {
+			return nil, fmt.Errorf("malformed segment id '%s'", p)
+		}
+		normalized = append(normalized, n)
+	}
+	return func(id string) bool {
+		for _, p := range normalized {
+			if strings.HasPrefix(id, p) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// segmentTypeFilter is either empty or one of the types returned by
+// inspect.SegmentType.
+type segmentTypeFilter string
+
+func (t *segmentTypeFilter) String() string {
+	return string(*t)
+}
+
+func (t *segmentTypeFilter) Set(s string) error {
+	switch s {
+	case "bulk", "data":
+		*t = segmentTypeFilter(s)
+	default:
+		return fmt.Errorf("Invalid segment type '%s'", s)
+	}
+	return nil
+}
+
+func (t *segmentTypeFilter) Type() string {
+	return "type"
+}
+
+func (t segmentTypeFilter) idFilter() inspect.IDFilter {
+	if t == "" {
+		return inspect.AnyID
+	}
+	return func(id string) bool {
+		return inspect.SegmentType(id) == string(t)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/francescomari/sdb/graph"
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/segment"
+)
+
+// testID is the ID of a segment used by the tests.
+type testID struct {
+	msb, lsb uint64
+}
+
+// The segments of the test fixtures. The segments 'a', 'b', 'd' and 'e' are
+// data segments, 'c' is a bulk segment.
+var (
+	testA = testID{0x1111111111114111, 0xa111111111111111}
+	testB = testID{0x2222222222224222, 0xa222222222222222}
+	testC = testID{0x3333333333334333, 0xb333333333333333}
+	testD = testID{0x4444444444444444, 0xa444444444444444}
+	testE = testID{0x5555555555554555, 0xa555555555555555}
+)
+
+func (id testID) String() string {
+	return fmt.Sprintf("%016x%016x", id.msb, id.lsb)
+}
+
+func (id testID) uuid() string {
+	s := id.String()
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// testRecord is a record of a test segment.
+type testRecord struct {
+	number int
+	typ    segment.RecordType
+	data   []byte
+}
+
+// testSegment describes a segment in the most recent format.
+type testSegment struct {
+	id         testID
+	generation int
+	references []testID
+	records    []testRecord
+}
+
+// data returns the segment serialized in the most recent format. The content
+// of the records is stored at the end of the segment, in the same order as the
+// records.
+func (s testSegment) data() []byte {
+	total := 0
+	for _, r := range s.records {
+		total += len(r.data)
+	}
+	var (
+		header = 32 + 16*len(s.references) + 9*len(s.records)
+		data   = make([]byte, header+total)
+	)
+	copy(data, "0aK")
+	data[3] = 13
+	binary.BigEndian.PutUint32(data[4:], uint32(s.generation))
+	binary.BigEndian.PutUint32(data[10:], uint32(s.generation))
+	binary.BigEndian.PutUint32(data[14:], uint32(len(s.references)))
+	binary.BigEndian.PutUint32(data[18:], uint32(len(s.records)))
+	for i, r := range s.references {
+		binary.BigEndian.PutUint64(data[32+16*i:], r.msb)
+		binary.BigEndian.PutUint64(data[32+16*i+8:], r.lsb)
+	}
+	offset := segment.MaxSize
+	for i, r := range s.records {
+		offset -= len(r.data)
+		p := 32 + 16*len(s.references) + 9*i
+		binary.BigEndian.PutUint32(data[p:], uint32(r.number))
+		data[p+4] = byte(r.typ)
+		binary.BigEndian.PutUint32(data[p+5:], uint32(offset))
+		copy(data[len(data)-(segment.MaxSize-offset):], r.data)
+	}
+	return data
+}
+
+// entry returns the TAR entry storing the segment.
+func (s testSegment) entry() testEntry {
+	data := s.data()
+	return testEntry{fmt.Sprintf("%s.%08x", s.id.uuid(), crc32.ChecksumIEEE(data)), data}
+}
+
+// rawEntry returns the TAR entry storing the bulk segment 's' the way the store
+// writes it: the content of its records, without a segment header.
+func (s testSegment) rawEntry() testEntry {
+	var data []byte
+	for _, r := range s.records {
+		data = append(data, r.data...)
+	}
+	return testEntry{fmt.Sprintf("%s.%08x", s.id.uuid(), crc32.ChecksumIEEE(data)), data}
+}
+
+// testEntry is an entry of a test TAR file.
+type testEntry struct {
+	name string
+	data []byte
+}
+
+// testIndex returns the index entry of a TAR file called 'name' containing the
+// segments 'segments', stored at the beginning of the TAR file in the same
+// order.
+func testIndex(name string, segments ...testSegment) testEntry {
+	var (
+		idx      index.Index
+		position = 0
+	)
+	for _, s := range segments {
+		size := len(s.data())
+		position += 512
+		idx.Entries = append(idx.Entries, index.Entry{
+			Msb:            s.id.msb,
+			Lsb:            s.id.lsb,
+			Position:       position,
+			Size:           size,
+			Generation:     s.generation,
+			FullGeneration: s.generation,
+		})
+		position += (size + 511) / 512 * 512
+	}
+	var b bytes.Buffer
+	if _, err := idx.WriteTo(&b); err != nil {
+		panic(err)
+	}
+	return testEntry{name + ".idx", b.Bytes()}
+}
+
+// testGraph returns the graph entry of a TAR file called 'name' containing the
+// references of 'segments'.
+func testGraph(name string, segments ...testSegment) testEntry {
+	var g graph.Graph
+	for _, s := range segments {
+		if len(s.references) == 0 {
+			continue
+		}
+		e := graph.Entry{Msb: s.id.msb, Lsb: s.id.lsb}
+		for _, r := range s.references {
+			e.References = append(e.References, graph.Reference{Msb: r.msb, Lsb: r.lsb})
+		}
+		g.Entries = append(g.Entries, e)
+	}
+	var b bytes.Buffer
+	if _, err := g.WriteTo(&b); err != nil {
+		panic(err)
+	}
+	return testEntry{name + ".gph", b.Bytes()}
+}
+
+// testStore returns the segments of a small, consistent store. 'a' references
+// 'b' and the bulk segment 'c', 'b' references 'a' and the missing segment 'd',
+// and nothing references 'e'.
+func testStore() []testSegment {
+	return []testSegment{
+		{testA, 1, []testID{testB, testC}, []testRecord{
+			{0, segment.RecordTypeValue, []byte("\x05hello")},
+			{1, segment.RecordTypeBlock, []byte("block")},
+		}},
+		{testB, 2, []testID{testA, testD}, []testRecord{
+			{0, segment.RecordTypeValue, []byte("\x03abc")},
+		}},
+		{testC, 2, nil, []testRecord{
+			{0, segment.RecordTypeBlock, bytes.Repeat([]byte{0xab}, 64)},
+		}},
+		{testE, 3, []testID{testA}, []testRecord{
+			{0, segment.RecordTypeValue, []byte("\x02hi")},
+		}},
+	}
+}
+
+// testStoreEntries returns the entries of a TAR file called 'name' containing
+// the segments of testStore, its index and its graph.
+func testStoreEntries(name string) []testEntry {
+	var (
+		segments = testStore()
+		entries  []testEntry
+	)
+	for _, s := range segments {
+		entries = append(entries, s.entry())
+	}
+	return append(entries, testGraph(name, segments...), testIndex(name, segments...))
+}
+
+// writeTestTar writes a TAR file containing 'entries' in a temporary directory
+// and returns its path.
+func writeTestTar(t testing.TB, name string, entries ...testEntry) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := tar.NewWriter(f)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Mode:     0644,
+			Size:     int64(len(e.data)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// corrupt returns a copy of 'e' whose last byte, part of the footer of an
+// index or of a graph, is changed.
+func corrupt(e testEntry) testEntry {
+	data := append([]byte(nil), e.data...)
+	data[len(data)-1] ^= 0xff
+	return testEntry{e.name, data}
+}
+
+// compressed returns a copy of 'e' whose content is compressed with gzip.
+func compressed(e testEntry) testEntry {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(e.data)
+	w.Close()
+	return testEntry{e.name, b.Bytes()}
+}
+
+// withPolicy runs 'f' with a fresh error policy writing warnings to a buffer,
+// and returns the warnings.
+func withPolicy(t testing.TB, strict bool, f func()) string {
+	t.Helper()
+	var (
+		w   bytes.Buffer
+		old = entryPolicy
+	)
+	entryPolicy = &errorPolicy{strict: strict, w: &w}
+	defer func() { entryPolicy = old }()
+	f()
+	return w.String()
+}
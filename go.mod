@@ -0,0 +1,8 @@
+module github.com/francescomari/sdb
+
+go 1.15
+
+require (
+	github.com/spf13/cobra v1.10.2
+	gopkg.in/yaml.v2 v2.4.0
+)
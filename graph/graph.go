@@ -90,7 +90,7 @@ func (graph *Graph) parseFrom(data []byte) error {
 		return fmt.Errorf("Invalid magic")
 	}
 
-	if size < footerSize {
+	if size < footerSize || size > n {
 		return fmt.Errorf("Invalid size")
 	}
 
@@ -152,3 +152,53 @@ func (reference *Reference) parseFrom(b *bytes.Buffer) error {
 
 	return nil
 }
+
+// WriteTo writes the content of the graph to the provided writer. It returns
+// the number of bytes written and an optional error.
+func (graph *Graph) WriteTo(w io.Writer) (int64, error) {
+	var entries bytes.Buffer
+
+	for _, entry := range graph.Entries {
+		entry.writeTo(&entries)
+	}
+
+	footer := make([]byte, footerSize)
+
+	binary.BigEndian.PutUint32(footer[footerChecksumOffset:], crc32.ChecksumIEEE(entries.Bytes()))
+	binary.BigEndian.PutUint32(footer[footerCountOffset:], uint32(len(graph.Entries)))
+	binary.BigEndian.PutUint32(footer[footerSizeOffset:], uint32(entries.Len()+footerSize))
+	binary.BigEndian.PutUint32(footer[footerMagicOffset:], graphMagic)
+
+	n, err := entries.WriteTo(w)
+
+	if err != nil {
+		return n, err
+	}
+
+	m, err := w.Write(footer)
+
+	return n + int64(m), err
+}
+
+func (entry *Entry) writeTo(b *bytes.Buffer) {
+	data := make([]byte, keySize)
+
+	binary.BigEndian.PutUint64(data[entryMsbOffset:], entry.Msb)
+	binary.BigEndian.PutUint64(data[entryLsbOffset:], entry.Lsb)
+	binary.BigEndian.PutUint32(data[entryCountOffset:], uint32(len(entry.References)))
+
+	b.Write(data)
+
+	for _, reference := range entry.References {
+		reference.writeTo(b)
+	}
+}
+
+func (reference *Reference) writeTo(b *bytes.Buffer) {
+	data := make([]byte, valueSize)
+
+	binary.BigEndian.PutUint64(data[referenceMsbOffset:], reference.Msb)
+	binary.BigEndian.PutUint64(data[referenceLsbOffset:], reference.Lsb)
+
+	b.Write(data)
+}
@@ -0,0 +1,158 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func testGraph() *Graph {
+	return &Graph{
+		Entries: []Entry{
+			{Msb: 1, Lsb: 2, References: []Reference{{Msb: 3, Lsb: 4}, {Msb: 5, Lsb: 6}}},
+			{Msb: 3, Lsb: 4, References: []Reference{{Msb: 1, Lsb: 2}}},
+		},
+	}
+}
+
+func testGraphData(t *testing.T) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if _, err := testGraph().WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestReadCorrupted(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(data []byte) []byte
+	}{
+		{
+			name: "empty",
+			modify: func(data []byte) []byte {
+				return nil
+			},
+		},
+		{
+			name: "truncated",
+			modify: func(data []byte) []byte {
+				return data[len(data)-footerSize-1:]
+			},
+		},
+		{
+			name: "size larger than data",
+			modify: func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[len(data)-footerSize+footerSizeOffset:], uint32(len(data)+1))
+				return data
+			},
+		},
+		{
+			name: "size smaller than footer",
+			modify: func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[len(data)-footerSize+footerSizeOffset:], footerSize-1)
+				return data
+			},
+		},
+		{
+			name: "count larger than entries",
+			modify: func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[len(data)-footerSize+footerCountOffset:], 3)
+				return data
+			},
+		},
+		{
+			name: "invalid checksum",
+			modify: func(data []byte) []byte {
+				data[0] ^= 0xff
+				return data
+			},
+		},
+		{
+			name: "invalid magic",
+			modify: func(data []byte) []byte {
+				data[len(data)-1] ^= 0xff
+				return data
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var g Graph
+			if _, err := g.ReadFrom(bytes.NewReader(test.modify(testGraphData(t)))); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestWriteToRoundTrip(t *testing.T) {
+	sample, err := ioutil.ReadFile("testdata/data00000a.tar.gph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		graph func(t *testing.T) *Graph
+	}{
+		{
+			name: "sample",
+			graph: func(t *testing.T) *Graph {
+				var g Graph
+				if _, err := g.ReadFrom(bytes.NewReader(sample)); err != nil {
+					t.Fatal(err)
+				}
+				return &g
+			},
+		},
+		{
+			name: "constructed",
+			graph: func(t *testing.T) *Graph {
+				return testGraph()
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				g = test.graph(t)
+				b bytes.Buffer
+			)
+			n, err := g.WriteTo(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(b.Len()) {
+				t.Fatalf("got %d bytes written, want %d", n, b.Len())
+			}
+			var read Graph
+			if _, err := read.ReadFrom(&b); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&read, g) {
+				t.Fatalf("got %+v, want %+v", read, *g)
+			}
+		})
+	}
+}
+
+func TestWriteToSample(t *testing.T) {
+	sample, err := ioutil.ReadFile("testdata/data00000a.tar.gph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g Graph
+	if _, err := g.ReadFrom(bytes.NewReader(sample)); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if _, err := g.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), sample) {
+		t.Fatalf("got %x, want %x", b.Bytes(), sample)
+	}
+}
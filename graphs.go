@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/francescomari/sdb/graph"
+	"github.com/francescomari/sdb/inspect"
+)
+
+// orphans returns the IDs of the entries of the graph that are not referenced
+// by any other entry, in the order they appear in the graph.
+func orphans(gph *graph.Graph) []string {
+	referenced := make(map[string]bool)
+	for _, e := range gph.Entries {
+		from := inspect.SegmentID(e.Msb, e.Lsb)
+		for _, r := range e.References {
+			if to := inspect.SegmentID(r.Msb, r.Lsb); to != from {
+				referenced[to] = true
+			}
+		}
+	}
+	ids := []string{}
+	for _, e := range gph.Entries {
+		if id := inspect.SegmentID(e.Msb, e.Lsb); !referenced[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func doPrintOrphans(f inspect.Format, nt inspect.Notation, w io.Writer) handler {
+	switch f {
+	case inspect.FormatText:
+		return doPrintOrphansTo(nt, w)
+	case inspect.FormatJSON:
+		return doPrintOrphansJSONTo(w)
+	default:
+		return inspect.InvalidFormat()
+	}
+}
+
+func doPrintOrphansTo(nt inspect.Notation, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		for _, id := range orphans(&gph) {
+			fmt.Fprintln(w, nt.ID(id))
+		}
+		return nil
+	}
+}
+
+func doPrintOrphansJSONTo(w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(orphans(&gph))
+	}
+}
+
+// referrers returns the IDs of the entries of the graph referencing the segment
+// 'id', in the order they appear in the graph.
+func referrers(gph *graph.Graph, id string) []string {
+	ids := []string{}
+	for _, e := range gph.Entries {
+		for _, r := range e.References {
+			if inspect.SegmentID(r.Msb, r.Lsb) == id {
+				ids = append(ids, inspect.SegmentID(e.Msb, e.Lsb))
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func doPrintReferrers(f inspect.Format, id string, nt inspect.Notation, w io.Writer) handler {
+	switch f {
+	case inspect.FormatText:
+		return doPrintReferrersTo(id, nt, w)
+	case inspect.FormatJSON:
+		return doPrintReferrersJSONTo(id, w)
+	default:
+		return inspect.InvalidFormat()
+	}
+}
+
+func doPrintReferrersTo(id string, nt inspect.Notation, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		for _, id := range referrers(&gph, id) {
+			fmt.Fprintln(w, nt.ID(id))
+		}
+		return nil
+	}
+}
+
+func doPrintReferrersJSONTo(id string, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(referrers(&gph, id))
+	}
+}
+
+// cycles returns the cycles found by a depth-first visit of the graph. Every
+// cycle is reported as the list of segments forming it, starting from the
+// segment first reached by the visit. A segment referencing itself is a cycle
+// of length one. Only the cycles closed by a back edge of the visit are
+// reported, which is enough to prove that the graph is not acyclic.
+func cycles(gph *graph.Graph) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		adjacency = make(map[string][]string)
+		order     []string
+		state     = make(map[string]int)
+		stack     []string
+		found     = [][]string{}
+	)
+
+	for _, e := range gph.Entries {
+		from := inspect.SegmentID(e.Msb, e.Lsb)
+		order = append(order, from)
+		for _, r := range e.References {
+			adjacency[from] = append(adjacency[from], inspect.SegmentID(r.Msb, r.Lsb))
+		}
+	}
+
+	var visit func(id string)
+
+	visit = func(id string) {
+		state[id] = visiting
+		stack = append(stack, id)
+		for _, next := range adjacency[id] {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == next {
+						found = append(found, append([]string(nil), stack[i:]...))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = visited
+	}
+
+	for _, id := range order {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+
+	return found
+}
+
+func doPrintCycles(f inspect.Format, nt inspect.Notation, w io.Writer) handler {
+	switch f {
+	case inspect.FormatText:
+		return doPrintCyclesTo(nt, w)
+	case inspect.FormatJSON:
+		return doPrintCyclesJSONTo(w)
+	default:
+		return inspect.InvalidFormat()
+	}
+}
+
+func doPrintCyclesTo(nt inspect.Notation, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		found := cycles(&gph)
+		for _, c := range found {
+			printed := make([]string, len(c))
+			for i, id := range c {
+				printed[i] = nt.ID(id)
+			}
+			fmt.Fprintln(w, strings.Join(printed, " "))
+		}
+		return cyclesError(found)
+	}
+}
+
+func doPrintCyclesJSONTo(w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		found := cycles(&gph)
+		if found == nil {
+			found = [][]string{}
+		}
+		if err := json.NewEncoder(w).Encode(found); err != nil {
+			return err
+		}
+		return cyclesError(found)
+	}
+}
+
+func cyclesError(found [][]string) error {
+	if len(found) == 0 {
+		return nil
+	}
+	return verificationFailed("found %d cycles", len(found))
+}
+
+type reachedSegment struct {
+	ID    string `json:"id"`
+	Depth int    `json:"depth"`
+}
+
+// reachable returns the segments reachable from the segment 'root', in
+// breadth-first order. The root itself is not returned. If 'maxDepth' is not
+// negative, only the segments at most 'maxDepth' references away from the root
+// are returned. The root must be in the graph, either as an entry or as a
+// reference: segments without references don't have an entry.
+func reachable(gph *graph.Graph, root string, maxDepth int) ([]reachedSegment, error) {
+	var (
+		known     = make(map[string]bool)
+		adjacency = make(map[string][]string)
+	)
+	for _, e := range gph.Entries {
+		from := inspect.SegmentID(e.Msb, e.Lsb)
+		known[from] = true
+		for _, r := range e.References {
+			to := inspect.SegmentID(r.Msb, r.Lsb)
+			known[to] = true
+			adjacency[from] = append(adjacency[from], to)
+		}
+	}
+	if !known[root] {
+		return nil, fmt.Errorf("segment %s not found", root)
+	}
+	var (
+		reached = []reachedSegment{}
+		visited = map[string]bool{root: true}
+		queue   = []reachedSegment{{root, 0}}
+	)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if maxDepth >= 0 && current.Depth >= maxDepth {
+			continue
+		}
+		for _, next := range adjacency[current.ID] {
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			s := reachedSegment{next, current.Depth + 1}
+			reached = append(reached, s)
+			queue = append(queue, s)
+		}
+	}
+	return reached, nil
+}
+
+func doPrintReachable(f inspect.Format, root string, maxDepth int, showDepth bool, nt inspect.Notation, w io.Writer) handler {
+	switch f {
+	case inspect.FormatText:
+		return doPrintReachableTo(root, maxDepth, showDepth, nt, w)
+	case inspect.FormatJSON:
+		return doPrintReachableJSONTo(root, maxDepth, showDepth, w)
+	default:
+		return inspect.InvalidFormat()
+	}
+}
+
+func doPrintReachableTo(root string, maxDepth int, showDepth bool, nt inspect.Notation, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		reached, err := reachable(&gph, root, maxDepth)
+		if err != nil {
+			return err
+		}
+		for _, s := range reached {
+			if showDepth {
+				fmt.Fprintf(w, "%s %d\n", nt.ID(s.ID), s.Depth)
+			} else {
+				fmt.Fprintln(w, nt.ID(s.ID))
+			}
+		}
+		return nil
+	}
+}
+
+func doPrintReachableJSONTo(root string, maxDepth int, showDepth bool, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		reached, err := reachable(&gph, root, maxDepth)
+		if err != nil {
+			return err
+		}
+		if showDepth {
+			return json.NewEncoder(w).Encode(reached)
+		}
+		ids := make([]string, 0, len(reached))
+		for _, s := range reached {
+			ids = append(ids, s.ID)
+		}
+		return json.NewEncoder(w).Encode(ids)
+	}
+}
+
+type danglingReference struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// danglingReferences returns the references pointing to segments that don't
+// have an entry in the graph.
+func danglingReferences(gph *graph.Graph) []danglingReference {
+	entries := make(map[string]bool)
+	for _, e := range gph.Entries {
+		entries[inspect.SegmentID(e.Msb, e.Lsb)] = true
+	}
+	dangling := []danglingReference{}
+	for _, e := range gph.Entries {
+		for _, r := range e.References {
+			if to := inspect.SegmentID(r.Msb, r.Lsb); !entries[to] {
+				dangling = append(dangling, danglingReference{inspect.SegmentID(e.Msb, e.Lsb), to})
+			}
+		}
+	}
+	return dangling
+}
+
+func doCheckDangling(f inspect.Format, nt inspect.Notation, w io.Writer) handler {
+	switch f {
+	case inspect.FormatText:
+		return doCheckDanglingTo(nt, w)
+	case inspect.FormatJSON:
+		return doCheckDanglingJSONTo(w)
+	default:
+		return inspect.InvalidFormat()
+	}
+}
+
+func doCheckDanglingTo(nt inspect.Notation, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		dangling := danglingReferences(&gph)
+		for _, d := range dangling {
+			fmt.Fprintf(w, "%s %s\n", nt.ID(d.From), nt.ID(d.To))
+		}
+		return danglingError(dangling)
+	}
+}
+
+func doCheckDanglingJSONTo(w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		dangling := danglingReferences(&gph)
+		if err := json.NewEncoder(w).Encode(dangling); err != nil {
+			return err
+		}
+		return danglingError(dangling)
+	}
+}
+
+func danglingError(dangling []danglingReference) error {
+	if len(dangling) == 0 {
+		return nil
+	}
+	return verificationFailed("found %d dangling references", len(dangling))
+}
+
+type reverseEntry struct {
+	ID        string   `json:"id"`
+	Referrers []string `json:"referrers"`
+}
+
+// reverse returns, for every referenced segment accepted by 'keep', the
+// segments referencing it. The referenced segments are returned in the order
+// they first appear in the graph.
+func reverse(gph *graph.Graph, keep inspect.IDFilter) []reverseEntry {
+	var (
+		entries   = []reverseEntry{}
+		positions = make(map[string]int)
+	)
+	for _, e := range gph.Entries {
+		from := inspect.SegmentID(e.Msb, e.Lsb)
+		for _, r := range e.References {
+			to := inspect.SegmentID(r.Msb, r.Lsb)
+			if !keep(to) {
+				continue
+			}
+			i, ok := positions[to]
+			if !ok {
+				i = len(entries)
+				positions[to] = i
+				entries = append(entries, reverseEntry{to, nil})
+			}
+			entries[i].Referrers = append(entries[i].Referrers, from)
+		}
+	}
+	return entries
+}
+
+func doPrintReverseGraph(f inspect.Format, keep inspect.IDFilter, nt inspect.Notation, w io.Writer) handler {
+	switch f {
+	case inspect.FormatText:
+		return doPrintReverseGraphTo(keep, nt, w)
+	case inspect.FormatJSON:
+		return doPrintReverseGraphJSONTo(keep, w)
+	default:
+		return inspect.InvalidFormat()
+	}
+}
+
+func doPrintReverseGraphTo(keep inspect.IDFilter, nt inspect.Notation, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		for _, e := range reverse(&gph, keep) {
+			for _, from := range e.Referrers {
+				fmt.Fprintf(w, "%s %s\n", nt.ID(e.ID), nt.ID(from))
+			}
+		}
+		return nil
+	}
+}
+
+func doPrintReverseGraphJSONTo(keep inspect.IDFilter, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(reverse(&gph, keep))
+	}
+}
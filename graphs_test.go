@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/francescomari/sdb/graph"
+	"github.com/francescomari/sdb/inspect"
+)
+
+// testGraphOf returns the graph of the references of 'segments'. Unlike the
+// graph stored in a TAR file, segments without references have an entry too.
+func testGraphOf(segments ...testSegment) *graph.Graph {
+	var g graph.Graph
+	for _, s := range segments {
+		e := graph.Entry{Msb: s.id.msb, Lsb: s.id.lsb}
+		for _, r := range s.references {
+			e.References = append(e.References, graph.Reference{Msb: r.msb, Lsb: r.lsb})
+		}
+		g.Entries = append(g.Entries, e)
+	}
+	return &g
+}
+
+func TestReachable(t *testing.T) {
+	var (
+		entry = testGraph("data00000a.tar", testStore()...)
+		gph   graph.Graph
+	)
+	if _, err := gph.ReadFrom(bytes.NewReader(entry.data)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		root     string
+		maxDepth int
+		want     []reachedSegment
+		wantErr  bool
+	}{
+		{
+			name:     "all",
+			root:     testE.String(),
+			maxDepth: -1,
+			want: []reachedSegment{
+				{testA.String(), 1},
+				{testB.String(), 2},
+				{testC.String(), 2},
+				{testD.String(), 3},
+			},
+		},
+		{
+			name:     "max depth",
+			root:     testE.String(),
+			maxDepth: 1,
+			want:     []reachedSegment{{testA.String(), 1}},
+		},
+		{
+			name:     "root without references",
+			root:     testC.String(),
+			maxDepth: -1,
+			want:     []reachedSegment{},
+		},
+		{
+			name:     "root referenced but missing",
+			root:     testD.String(),
+			maxDepth: -1,
+			want:     []reachedSegment{},
+		},
+		{
+			name:     "unknown root",
+			root:     testID{0x7777777777774777, 0xa777777777777777}.String(),
+			maxDepth: -1,
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := reachable(&gph, test.root, test.maxDepth)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGraphModesNotation(t *testing.T) {
+	var (
+		nt      = inspect.Notation{Dashed: true, Upper: true}
+		plain   = regexp.MustCompile(`[0-9a-fA-F]{32}`)
+		entries = testStoreEntries("data00000a.tar")
+		b       bytes.Buffer
+	)
+	tests := []struct {
+		name string
+		h    handler
+		want testID
+	}{
+		{"orphans", doPrintOrphans(inspect.FormatText, nt, &b), testE},
+		{"referrers", doPrintReferrers(inspect.FormatText, testB.String(), nt, &b), testA},
+		{"cycles", doPrintCycles(inspect.FormatText, nt, &b), testA},
+		{"reachable", doPrintReachable(inspect.FormatText, testE.String(), -1, true, nt, &b), testA},
+		{"dangling", doCheckDangling(inspect.FormatText, nt, &b), testD},
+		{"reverse", doPrintReverseGraph(inspect.FormatText, inspect.AnyID, nt, &b), testA},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b.Reset()
+			p := writeTestTar(t, "data00000a.tar", entries...)
+			onMatchingEntry(p, isGraph, test.h)
+			if plain.MatchString(b.String()) || !strings.Contains(b.String(), strings.ToUpper(test.want.uuid())) {
+				t.Fatalf("unexpected output %q", b.String())
+			}
+		})
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []testSegment
+		want     []string
+	}{
+		{"store", testStore(), []string{testE.String()}},
+		{"self reference", []testSegment{
+			{id: testA, references: []testID{testA}},
+			{id: testB, references: []testID{testA}},
+		}, []string{testB.String()}},
+		{"cycle", []testSegment{
+			{id: testA, references: []testID{testB}},
+			{id: testB, references: []testID{testA}},
+		}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := orphans(testGraphOf(test.segments...)); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintOrphansJSON(t *testing.T) {
+	var (
+		gph = testGraph("data00000a.tar", testStore()...)
+		b   bytes.Buffer
+	)
+	if err := doPrintOrphans(inspect.FormatJSON, inspect.Notation{}, &b)(gph.name, bytes.NewReader(gph.data)); err != nil {
+		t.Fatal(err)
+	}
+	if want := `["` + testE.String() + `"]` + "\n"; b.String() != want {
+		t.Fatalf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []testSegment
+		want     [][]string
+	}{
+		{"acyclic", []testSegment{
+			{id: testA, references: []testID{testB, testC}},
+			{id: testB, references: []testID{testC}},
+			{id: testC},
+		}, [][]string{}},
+		{"three nodes", []testSegment{
+			{id: testA, references: []testID{testB}},
+			{id: testB, references: []testID{testC}},
+			{id: testC, references: []testID{testA}},
+		}, [][]string{{testA.String(), testB.String(), testC.String()}}},
+		{"self reference", []testSegment{
+			{id: testA, references: []testID{testA}},
+		}, [][]string{{testA.String()}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := cycles(testGraphOf(test.segments...))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			if err := cyclesError(got); (err != nil) != (len(test.want) > 0) {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestDanglingReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []testSegment
+		want     []danglingReference
+	}{
+		{"clean", []testSegment{
+			{id: testA, references: []testID{testB}},
+			{id: testB, references: []testID{testA}},
+		}, []danglingReference{}},
+		{"missing", testStore(), []danglingReference{{testB.String(), testD.String()}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := danglingReferences(testGraphOf(test.segments...))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			err := danglingError(got)
+			if (err != nil) != (len(test.want) > 0) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil && exitCode(err) != exitVerificationError {
+				t.Fatalf("got exit code %d, want %d", exitCode(err), exitVerificationError)
+			}
+		})
+	}
+}
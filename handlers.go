@@ -1,206 +1,296 @@
 package main
 
 import (
+	"bytes"
 	"encoding/hex"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 
-	"github.com/francescomari/sdb/binaries"
-	"github.com/francescomari/sdb/graph"
 	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
 	"github.com/francescomari/sdb/segment"
 )
 
-var errInvalidFormat = errors.New("Invalid format")
-
-func invalidFormat() handler {
-	return func(_ string, _ io.Reader) error {
-		return errInvalidFormat
-	}
-}
-
 func doPrintTo(w io.Writer) func(n string) {
 	return func(n string) {
 		fmt.Fprintln(w, n)
 	}
 }
 
-func doPrintBinaries(f format, w io.Writer) handler {
-	switch f {
-	case formatHex:
-		return doPrintHexTo(w)
-	case formatText:
-		return doPrintBinariesTo(w)
-	default:
-		return invalidFormat()
-	}
-}
-
-func doPrintBinariesTo(w io.Writer) handler {
-	return func(_ string, r io.Reader) error {
-		var bns binaries.Binaries
-		if _, err := bns.ReadFrom(r); err != nil {
+// onSegmentVersion calls 'h' only if the version of the segment is between
+// 'min' and 'max', inclusive, and returns an error otherwise. If 'max' is
+// negative, the version is not bounded from above.
+func onSegmentVersion(min, max int, h handler) handler {
+	return func(n string, r io.Reader) error {
+		var b bytes.Buffer
+		if _, err := inspect.Parse(b.ReadFrom, r); err != nil {
 			return err
 		}
-		for _, g := range bns.Generations {
-			for _, s := range g.Segments {
-				for _, r := range s.References {
-					fmt.Fprintf(w, "%d %d %v %s %s\n", g.Generation, g.FullGeneration, g.Compacted, segmentID(s.Msb, s.Lsb), r)
-				}
-			}
+		var s segment.Segment
+		if _, err := inspect.Parse(s.ReadFrom, bytes.NewReader(b.Bytes())); err != nil {
+			return err
+		}
+		if s.Version >= min && (max < 0 || s.Version <= max) {
+			return h(n, &b)
+		}
+		switch {
+		case max < 0:
+			return fmt.Errorf("unsupported segment version %d, expected %d or newer", s.Version, min)
+		case min <= 0:
+			return fmt.Errorf("unsupported segment version %d, expected %d or older", s.Version, max)
+		default:
+			return fmt.Errorf("unsupported segment version %d, expected %d to %d", s.Version, min, max)
 		}
-		return nil
 	}
 }
 
-func doPrintGraph(f format, w io.Writer) handler {
-	switch f {
-	case formatHex:
-		return doPrintHexTo(w)
-	case formatText:
-		return doPrintGraphTo(w)
-	default:
-		return invalidFormat()
+func doPrintSegmentNameTo(nt inspect.Notation, w io.Writer) handler {
+	return func(n string, _ io.Reader) error {
+		id := inspect.EntrySegmentID(n)
+		if err := inspect.CheckSegmentID(id); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s %s\n", inspect.SegmentType(id), nt.ID(id))
+		return nil
 	}
 }
 
-func doPrintGraphTo(w io.Writer) handler {
+// doListSegments prints the type and the ID of every segment in an index
+// accepted by 'keep', or only the number of those segments if 'count' is true.
+func doListSegments(keep inspect.IDFilter, count bool, nt inspect.Notation, w io.Writer) handler {
 	return func(_ string, r io.Reader) error {
-		var gph graph.Graph
-		if _, err := gph.ReadFrom(r); err != nil {
+		var idx index.Index
+		if _, err := inspect.Parse(idx.ReadFrom, r); err != nil {
 			return err
 		}
-		for _, e := range gph.Entries {
-			for _, r := range e.References {
-				fmt.Fprintf(w, "%s %s\n", segmentID(e.Msb, e.Lsb), segmentID(r.Msb, r.Lsb))
+		n := 0
+		for _, e := range idx.Entries {
+			id := inspect.SegmentID(e.Msb, e.Lsb)
+			if !keep(id) {
+				continue
+			}
+			if !count {
+				fmt.Fprintf(w, "%s %s\n", inspect.SegmentType(id), nt.SegmentID(e.Msb, e.Lsb))
 			}
+			n++
+		}
+		if count {
+			fmt.Fprintln(w, n)
 		}
 		return nil
 	}
 }
 
-func doPrintIndex(f format, w io.Writer) handler {
+type recordCounts struct {
+	Types      map[string]int `json:"types"`
+	Total      int            `json:"total"`
+	References int            `json:"references"`
+}
+
+// newRecordCounts counts the records accepted by 'keep' in a segment, grouped
+// by type. Types without records are omitted.
+func newRecordCounts(s *segment.Segment, keep inspect.RecordFilter) recordCounts {
+	c := recordCounts{
+		Types:      make(map[string]int),
+		References: len(s.References),
+	}
+	for _, r := range s.Records {
+		if !keep(r) {
+			continue
+		}
+		c.Types[inspect.RecordType(r.Type)]++
+		c.Total++
+	}
+	return c
+}
+
+func doPrintRecordCounts(f inspect.Format, keep inspect.RecordFilter, w io.Writer) handler {
 	switch f {
-	case formatHex:
-		return doPrintHexTo(w)
-	case formatText:
-		return doPrintIndexTo(w)
+	case inspect.FormatText:
+		return doPrintRecordCountsTo(keep, w)
+	case inspect.FormatJSON:
+		return doPrintRecordCountsJSONTo(keep, w)
 	default:
-		return invalidFormat()
+		return inspect.InvalidFormat()
 	}
 }
 
-func doPrintIndexTo(w io.Writer) handler {
+func doPrintRecordCountsTo(keep inspect.RecordFilter, w io.Writer) handler {
 	return func(_ string, r io.Reader) error {
-		var idx index.Index
-		if _, err := idx.ReadFrom(r); err != nil {
+		var s segment.Segment
+		if _, err := inspect.Parse(s.ReadFrom, r); err != nil {
 			return err
 		}
-		for _, e := range idx.Entries {
-			id := segmentID(e.Msb, e.Lsb)
-			fmt.Fprintf(w, "%s %s %x %d %d %d %v\n", segmentType(id), id, e.Position, e.Size, e.Generation, e.FullGeneration, e.Compacted)
+		c := newRecordCounts(&s, keep)
+		var names []string
+		for name := range c.Types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s %d\n", name, c.Types[name])
 		}
+		fmt.Fprintf(w, "total %d\n", c.Total)
+		fmt.Fprintf(w, "references %d\n", c.References)
 		return nil
 	}
 }
 
-func doPrintSegmentNameTo(w io.Writer) handler {
-	return func(n string, _ io.Reader) error {
-		id := normalizeSegmentID(entryNameToSegmentID(n))
-		fmt.Fprintf(w, "%s %s\n", segmentType(id), id)
-		return nil
+func doPrintRecordCountsJSONTo(keep inspect.RecordFilter, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var s segment.Segment
+		if _, err := inspect.Parse(s.ReadFrom, r); err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(newRecordCounts(&s, keep))
 	}
 }
 
-func doPrintSegment(f format, w io.Writer) handler {
-	switch f {
-	case formatHex:
-		return doPrintHexTo(w)
-	case formatText:
-		return doPrintSegmentTo(w)
-	default:
-		return invalidFormat()
+// parseRecordNumber parses a record number. The number is hexadecimal, like in
+// the output of the segment command, and can optionally be prefixed by '0x'.
+func parseRecordNumber(s string) (int, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	n, err := strconv.ParseUint(digits, 16, 31)
+	if err != nil {
+		return 0, fmt.Errorf("malformed record number '%s'", s)
 	}
+	return int(n), nil
 }
 
-func doPrintSegmentTo(w io.Writer) handler {
+// doPrintRecordTo prints a hex dump of the bytes of the record with the
+// specified number, or the bytes themselves if 'raw' is true.
+func doPrintRecordTo(number int, raw bool, w io.Writer) handler {
 	return func(_ string, r io.Reader) error {
 		var s segment.Segment
-		if _, err := s.ReadFrom(r); err != nil {
+		if _, err := inspect.Parse(s.ReadFrom, r); err != nil {
 			return err
 		}
-		fmt.Fprintf(w, "version %d\n", s.Version)
-		fmt.Fprintf(w, "generation %d\n", s.Generation)
-		fmt.Fprintf(w, "fullGeneration %d\n", s.FullGeneration)
-		fmt.Fprintf(w, "compacted %v\n", s.Compacted)
-		for i, r := range s.References {
-			fmt.Fprintf(w, "reference %d %s\n", i+1, segmentID(r.Msb, r.Lsb))
-		}
 		for _, r := range s.Records {
-			fmt.Fprintf(w, "record %x %s %x\n", r.Number, recordType(r.Type), r.Offset)
+			if r.Number != number {
+				continue
+			}
+			data, err := s.RecordData(r)
+			if err != nil {
+				return err
+			}
+			if raw {
+				_, err = w.Write(data)
+				return err
+			}
+			d := hex.Dumper(w)
+			defer d.Close()
+			_, err = d.Write(data)
+			return err
 		}
-		return nil
+		return fmt.Errorf("record %x not found, the segment has %d records", number, len(s.Records))
 	}
 }
 
-func doPrintNameTo(w io.Writer) handler {
-	return func(n string, _ io.Reader) error {
-		fmt.Fprintln(w, n)
-		return nil
-	}
+type segmentHeader struct {
+	Version        int  `json:"version"`
+	Generation     int  `json:"generation"`
+	FullGeneration int  `json:"fullGeneration"`
+	Compacted      bool `json:"compacted"`
+	References     int  `json:"references"`
+	Records        int  `json:"records"`
+	HeaderSize     int  `json:"headerSize"`
 }
 
-func doPrintHexTo(w io.Writer) handler {
-	return func(_ string, r io.Reader) (err error) {
-		d := hex.Dumper(w)
-		defer d.Close()
-		_, err = io.Copy(d, r)
-		return
+func newSegmentHeader(s *segment.Segment) segmentHeader {
+	return segmentHeader{
+		Version:        s.Version,
+		Generation:     s.Generation,
+		FullGeneration: s.FullGeneration,
+		Compacted:      s.Compacted,
+		References:     len(s.References),
+		Records:        len(s.Records),
+		HeaderSize:     s.HeaderSize(),
 	}
 }
 
-func isBulkSegmentID(id string) bool {
-	return id[16] == 'b'
-}
-
-func normalizeSegmentID(id string) string {
-	return strings.ToLower(strings.TrimSpace(strings.Replace(id, "-", "", -1)))
-}
-
-func recordType(t segment.RecordType) string {
-	switch t {
-	case segment.RecordTypeBlock:
-		return "block"
-	case segment.RecordTypeList:
-		return "list"
-	case segment.RecordTypeListBucket:
-		return "bucket"
-	case segment.RecordTypeMapBranch:
-		return "branch"
-	case segment.RecordTypeMapLeaf:
-		return "leaf"
-	case segment.RecordTypeNode:
-		return "node"
-	case segment.RecordTypeTemplate:
-		return "template"
-	case segment.RecordTypeValue:
-		return "value"
-	case segment.RecordTypeBlobID:
-		return "binary"
-	default:
-		return "unknown"
+// doPrintSegmentHeader prints the fields of the header of a segment on one
+// line, or a hex dump of the bytes of the header, including the tables of the
+// references and of the records, in hex format.
+func doPrintSegmentHeader(f inspect.Format, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var s segment.Segment
+		if _, err := inspect.Parse(s.ReadFrom, r); err != nil {
+			return err
+		}
+		h := newSegmentHeader(&s)
+		switch f {
+		case inspect.FormatText:
+			fmt.Fprintf(w, "version %d generation %d fullGeneration %d compacted %v references %d records %d headerSize %d\n", h.Version, h.Generation, h.FullGeneration, h.Compacted, h.References, h.Records, h.HeaderSize)
+			return nil
+		case inspect.FormatHex:
+			d := hex.Dumper(w)
+			defer d.Close()
+			_, err := d.Write(s.HeaderData())
+			return err
+		case inspect.FormatJSON:
+			return json.NewEncoder(w).Encode(h)
+		default:
+			return inspect.ErrInvalidFormat
+		}
 	}
 }
 
-func segmentType(id string) string {
-	if isBulkSegmentID(id) {
-		return "bulk"
+// doVerifySegment checks the structure of a segment. It prints a line for
+// every record whose offset is out of the bounds of the segment or whose
+// number is used by another record, and for every reference that is not a
+// well-formed segment ID, in notation 'nt'. It returns an error if any problem
+// is found.
+func doVerifySegment(nt inspect.Notation, w io.Writer) handler {
+	return func(n string, r io.Reader) error {
+		var s segment.Segment
+		if _, err := inspect.Parse(s.ReadFrom, r); err != nil {
+			return err
+		}
+		var (
+			problems int
+			numbers  = make(map[int]bool)
+			self     = inspect.EntrySegmentID(n)
+			start    = segment.MaxSize - (s.Size() - s.HeaderSize())
+		)
+		for _, r := range s.Records {
+			if r.Offset < start || r.Offset >= segment.MaxSize {
+				fmt.Fprintf(w, "record %s: offset %s out of bounds %s to %s\n", nt.Hex(r.Number), nt.Hex(r.Offset), nt.Hex(start), nt.Hex(segment.MaxSize))
+				problems++
+			}
+			if numbers[r.Number] {
+				fmt.Fprintf(w, "record %s: duplicate record number\n", nt.Hex(r.Number))
+				problems++
+			}
+			numbers[r.Number] = true
+		}
+		for i, ref := range s.References {
+			id := inspect.SegmentID(ref.Msb, ref.Lsb)
+			switch {
+			case (ref.Msb>>12)&0xf != 4:
+				fmt.Fprintf(w, "reference %d: malformed segment id %s, invalid version\n", i+1, nt.ID(id))
+				problems++
+			case ref.Lsb>>60 != 0xa && ref.Lsb>>60 != 0xb:
+				fmt.Fprintf(w, "reference %d: malformed segment id %s, invalid segment type\n", i+1, nt.ID(id))
+				problems++
+			case id == self:
+				fmt.Fprintf(w, "reference %d: segment %s references itself\n", i+1, nt.ID(id))
+				problems++
+			}
+		}
+		if problems > 0 {
+			return verificationFailed("found %d problems", problems)
+		}
+		return nil
 	}
-	return "data"
 }
 
-func segmentID(msb, lsb uint64) string {
-	return fmt.Sprintf("%016x%016x", msb, lsb)
+func doPrintNameTo(w io.Writer) handler {
+	return func(n string, _ io.Reader) error {
+		fmt.Fprintln(w, n)
+		return nil
+	}
 }
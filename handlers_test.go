@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/francescomari/sdb/inspect"
+	"github.com/francescomari/sdb/segment"
+)
+
+func TestPrintSegmentName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{testA.uuid() + ".0123abcd", "data " + testA.String() + "\n", ""},
+		{testC.uuid() + ".0123abcd", "bulk " + testC.String() + "\n", ""},
+		{"xyz", "", "malformed segment id 'xyz'"},
+		{"1111111111114111", "", "malformed segment id '1111111111114111'"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		err := doPrintSegmentNameTo(inspect.Notation{}, &b)(test.name, nil)
+		if test.wantErr == "" && err != nil {
+			t.Fatalf("%q: %v", test.name, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Fatalf("%q: got error %v, want %q", test.name, err, test.wantErr)
+		}
+		if b.String() != test.want {
+			t.Fatalf("%q: got %q, want %q", test.name, b.String(), test.want)
+		}
+	}
+}
+
+func TestPrintRecordCounts(t *testing.T) {
+	s := testSegment{
+		id:         testA,
+		references: []testID{testB, testC},
+		records: []testRecord{
+			{0, segment.RecordTypeValue, []byte("\x02hi")},
+			{1, segment.RecordTypeNode, make([]byte, 12)},
+			{2, segment.RecordTypeValue, []byte("\x02ho")},
+			{3, segment.RecordTypeBlock, []byte("block")},
+		},
+	}
+	tests := []struct {
+		format inspect.Format
+		want   string
+	}{
+		{inspect.FormatText, "block 1\nnode 1\nvalue 2\ntotal 4\nreferences 2\n"},
+		{inspect.FormatJSON, `{"types":{"block":1,"node":1,"value":2},"total":4,"references":2}` + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.format.String(), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := doPrintRecordCounts(test.format, inspect.AnyRecord, &b)("", bytes.NewReader(s.data())); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != test.want {
+				t.Fatalf("got %q, want %q", b.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestVerifySegment(t *testing.T) {
+	valid := testSegment{
+		id:         testA,
+		references: []testID{testB},
+		records: []testRecord{
+			{0, segment.RecordTypeValue, []byte("\x02hi")},
+			{1, segment.RecordTypeBlock, []byte("block")},
+		},
+	}
+	// withRecord returns the data of 'valid' with the number and the offset of
+	// the second record replaced.
+	withRecord := func(number, offset int) []byte {
+		data := valid.data()
+		p := 32 + 16*len(valid.references) + 9
+		binary.BigEndian.PutUint32(data[p:], uint32(number))
+		binary.BigEndian.PutUint32(data[p+5:], uint32(offset))
+		return data
+	}
+	withReference := func(r testID) []byte {
+		s := valid
+		s.references = []testID{r}
+		return s.data()
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"valid", valid.data(), ""},
+		{"offset out of bounds", withRecord(1, 0x100), "record 1: offset 100 out of bounds 3fff8 to 40000\n"},
+		{"offset past the end", withRecord(1, segment.MaxSize), "record 1: offset 40000 out of bounds 3fff8 to 40000\n"},
+		{"duplicate number", withRecord(0, segment.MaxSize-8), "record 0: duplicate record number\n"},
+		{"invalid version", withReference(testID{0x1111111111111111, 0xa111111111111111}), "reference 1: malformed segment id 1111111111111111a111111111111111, invalid version\n"},
+		{"invalid type", withReference(testID{0x1111111111114111, 0xc111111111111111}), "reference 1: malformed segment id 1111111111114111c111111111111111, invalid segment type\n"},
+		{"self reference", withReference(testA), "reference 1: segment " + testA.String() + " references itself\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			err := doVerifySegment(inspect.Notation{}, &b)(valid.entry().name, bytes.NewReader(test.data))
+			if (err != nil) != (test.want != "") {
+				t.Fatalf("got error %v, want error %v", err, test.want != "")
+			}
+			if err != nil && exitCode(err) != exitVerificationError {
+				t.Fatalf("got exit code %d, want %d", exitCode(err), exitVerificationError)
+			}
+			if b.String() != test.want {
+				t.Fatalf("got %q, want %q", b.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestPrintRecord(t *testing.T) {
+	s := testSegment{
+		id: testA,
+		records: []testRecord{
+			{0, segment.RecordTypeValue, []byte("\x02hi")},
+			{1, segment.RecordTypeBlock, []byte("block")},
+			{2, segment.RecordTypeValue, []byte("\x03abc")},
+		},
+	}
+	tests := []struct {
+		name    string
+		number  int
+		raw     bool
+		want    string
+		wantErr bool
+	}{
+		{"first", 0, true, "\x02hi", false},
+		{"middle", 1, true, "block", false},
+		{"last", 2, true, "\x03abc", false},
+		{"hex", 1, false, hex.Dump([]byte("block")), false},
+		{"missing", 3, true, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			err := doPrintRecordTo(test.number, test.raw, &b)("", bytes.NewReader(s.data()))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if b.String() != test.want {
+				t.Fatalf("got %q, want %q", b.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestPrintSegmentHeader(t *testing.T) {
+	s := testSegment{
+		id:         testA,
+		generation: 7,
+		references: []testID{testB},
+		records:    []testRecord{{0, segment.RecordTypeValue, []byte("\x02hi")}},
+	}
+	data := s.data()
+	headerSize := 32 + 16 + 9
+	tests := []struct {
+		format inspect.Format
+		want   string
+	}{
+		{inspect.FormatText, "version 13 generation 7 fullGeneration 7 compacted false references 1 records 1 headerSize 57\n"},
+		{inspect.FormatJSON, `{"version":13,"generation":7,"fullGeneration":7,"compacted":false,"references":1,"records":1,"headerSize":57}` + "\n"},
+		{inspect.FormatHex, hex.Dump(data[:headerSize])},
+	}
+	for _, test := range tests {
+		t.Run(test.format.String(), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := doPrintSegmentHeader(test.format, &b)("", bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != test.want {
+				t.Fatalf("got\n%s\nwant\n%s", b.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
+)
+
+// defaultHistogramEdges are the upper edges of the buckets of a histogram of
+// segment sizes, in powers of two from 1K to 256K.
+var defaultHistogramEdges = []int{
+	1 << 10, 2 << 10, 4 << 10, 8 << 10, 16 << 10,
+	32 << 10, 64 << 10, 128 << 10, 256 << 10,
+}
+
+// histogram counts the segments whose size falls in a bucket. The bucket with
+// the i-th edge contains the sizes greater than the previous edge and up to the
+// i-th edge. An additional bucket contains the sizes greater than the last
+// edge.
+type histogram struct {
+	edges  []int
+	counts []int
+	bytes  []int
+}
+
+func newHistogram(edges []int) *histogram {
+	return &histogram{
+		edges:  edges,
+		counts: make([]int, len(edges)+1),
+		bytes:  make([]int, len(edges)+1),
+	}
+}
+
+func (h *histogram) add(size int) {
+	i := 0
+	for i < len(h.edges) && size > h.edges[i] {
+		i++
+	}
+	h.counts[i]++
+	h.bytes[i] += size
+}
+
+// parseHistogramEdges parses the upper edges of the buckets of a histogram. An
+// edge is a number of bytes, optionally followed by K or M. The edges must be
+// positive and sorted in increasing order.
+func parseHistogramEdges(values []string) ([]int, error) {
+	var edges []int
+	for _, v := range values {
+		digits, multiplier := v, 1
+		switch {
+		case strings.HasSuffix(v, "K"):
+			digits, multiplier = strings.TrimSuffix(v, "K"), 1<<10
+		case strings.HasSuffix(v, "M"):
+			digits, multiplier = strings.TrimSuffix(v, "M"), 1<<20
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid bucket edge '%s'", v)
+		}
+		edge := n * multiplier
+		if len(edges) > 0 && edge <= edges[len(edges)-1] {
+			return nil, fmt.Errorf("bucket edge '%s' is not greater than the previous one", v)
+		}
+		edges = append(edges, edge)
+	}
+	return edges, nil
+}
+
+// formatHistogramEdge prints an edge in K or M if it is a multiple of them.
+func formatHistogramEdge(n int) string {
+	switch {
+	case n%(1<<20) == 0:
+		return fmt.Sprintf("%dM", n>>20)
+	case n%(1<<10) == 0:
+		return fmt.Sprintf("%dK", n>>10)
+	default:
+		return strconv.Itoa(n)
+	}
+}
+
+// terminalWidth returns the width of the terminal from the COLUMNS environment
+// variable, or 80 if the variable is not set.
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+// printHistogram prints a line for every bucket of the histogram, including
+// the empty ones. Every line contains the upper edge of the bucket, the number
+// of segments and their total size, followed by a bar proportional to the
+// number of segments. The lines fit in 'width' columns, unless the bars would
+// be too short to be readable.
+func printHistogram(h *histogram, width int, w io.Writer) {
+	const minBarWidth = 10
+	var (
+		labels     = make([]string, len(h.counts))
+		labelWidth int
+		countWidth int
+		bytesWidth int
+		maxCount   int
+	)
+	for i := range h.counts {
+		if i < len(h.edges) {
+			labels[i] = "<=" + formatHistogramEdge(h.edges[i])
+		} else {
+			labels[i] = ">" + formatHistogramEdge(h.edges[len(h.edges)-1])
+		}
+		if n := len(labels[i]); n > labelWidth {
+			labelWidth = n
+		}
+		if n := len(strconv.Itoa(h.counts[i])); n > countWidth {
+			countWidth = n
+		}
+		if n := len(strconv.Itoa(h.bytes[i])); n > bytesWidth {
+			bytesWidth = n
+		}
+		if h.counts[i] > maxCount {
+			maxCount = h.counts[i]
+		}
+	}
+	barWidth := width - labelWidth - countWidth - bytesWidth - 3
+	if barWidth < minBarWidth {
+		barWidth = minBarWidth
+	}
+	for i := range h.counts {
+		line := fmt.Sprintf("%-*s %*d %*d", labelWidth, labels[i], countWidth, h.counts[i], bytesWidth, h.bytes[i])
+		if h.counts[i] > 0 {
+			bar := h.counts[i] * barWidth / maxCount
+			if bar == 0 {
+				bar = 1
+			}
+			line += " " + strings.Repeat("#", bar)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// printHistograms prints the histogram of the data segments and the histogram
+// of the bulk segments, each preceded by a heading, or a single histogram if
+// 'data' and 'bulk' are the same.
+func printHistograms(data, bulk *histogram, width int, w io.Writer) {
+	if data == bulk {
+		printHistogram(data, width, w)
+		return
+	}
+	fmt.Fprintln(w, "data")
+	printHistogram(data, width, w)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "bulk")
+	printHistogram(bulk, width, w)
+}
+
+// doCollectHistograms returns a handler adding the sizes of the segments in an
+// index to 'data' and 'bulk', according to the type of the segments. 'data' and
+// 'bulk' can be the same histogram.
+func doCollectHistograms(data, bulk *histogram) handler {
+	return func(_ string, r io.Reader) error {
+		var idx index.Index
+		if _, err := inspect.Parse(idx.ReadFrom, r); err != nil {
+			return err
+		}
+		for _, e := range idx.Entries {
+			if inspect.IsBulkSegmentID(inspect.SegmentID(e.Msb, e.Lsb)) {
+				bulk.add(e.Size)
+			} else {
+				data.add(e.Size)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintHistograms(t *testing.T) {
+	edges := []int{1 << 10, 4 << 10}
+	tests := []struct {
+		name   string
+		byType bool
+		want   string
+	}{
+		{
+			name: "combined",
+			want: "" +
+				"<=1K 2  612 ##########\n" +
+				"<=4K 1 2048 #####\n" +
+				">4K  1 8192 #####\n",
+		},
+		{
+			name:   "by type",
+			byType: true,
+			want: "" +
+				"data\n" +
+				"<=1K 2 612 ###########\n" +
+				"<=4K 0   0\n" +
+				">4K  0   0\n" +
+				"\n" +
+				"bulk\n" +
+				"<=1K 0    0\n" +
+				"<=4K 1 2048 ##########\n" +
+				">4K  1 8192 ##########\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				data = newHistogram(edges)
+				bulk = data
+			)
+			if test.byType {
+				bulk = newHistogram(edges)
+			}
+			data.add(100)
+			data.add(512)
+			bulk.add(2048)
+			bulk.add(8192)
+			var b bytes.Buffer
+			printHistograms(data, bulk, 22, &b)
+			if got := b.String(); got != test.want {
+				t.Fatalf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseHistogramEdges(t *testing.T) {
+	tests := []struct {
+		values  []string
+		want    []int
+		wantErr bool
+	}{
+		{[]string{"512", "1K", "2M"}, []int{512, 1 << 10, 2 << 20}, false},
+		{[]string{"1K", "1K"}, nil, true},
+		{[]string{"0"}, nil, true},
+		{[]string{"1G"}, nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseHistogramEdges(test.values)
+		if (err != nil) != test.wantErr {
+			t.Fatalf("%v: got error %v, want error %v", test.values, err, test.wantErr)
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("%v: got %v, want %v", test.values, got, test.want)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("%v: got %v, want %v", test.values, got, test.want)
+			}
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 // Index is a catalog of every segment stored in a TAR file.
 type Index struct {
 	Entries []Entry
+
+	byID map[[2]uint64]int
 }
 
 // Entry is a reference to a segment. An Index is composed of one or more
@@ -124,6 +126,7 @@ func (index *Index) parseV1(data []byte) error {
 	}
 
 	index.Entries = nil
+	index.byID = nil
 
 	for i := 0; i < count; i++ {
 		entry := entries[i*indexEntrySize:]
@@ -207,6 +210,7 @@ func (index *Index) parseV2(data []byte) error {
 	}
 
 	index.Entries = nil
+	index.byID = nil
 
 	for i := 0; i < count; i++ {
 		entry := entries[i*indexEntrySize:]
@@ -234,3 +238,88 @@ func (index *Index) parseV2(data []byte) error {
 
 	return nil
 }
+
+// WriteTo writes the index to 'w' in the most recent format and returns the
+// number of bytes written and an error.
+func (index *Index) WriteTo(w io.Writer) (int64, error) {
+	const (
+		indexMagic     = v2Magic
+		footerSize     = 16
+		indexEntrySize = 33
+	)
+
+	const (
+		footerChecksumOffset = 0
+		footerCountOffset    = 4
+		footerSizeOffset     = 8
+		footerMagicOffset    = 12
+	)
+
+	const (
+		entryMsbOffset            = 0
+		entryLsbOffset            = 8
+		entryPositionOffset       = 16
+		entrySizeOffset           = 20
+		entryGenerationOffset     = 24
+		entryFullGenerationOffset = 28
+		entryCompactedOffset      = 32
+	)
+
+	var (
+		count   = len(index.Entries)
+		entries = make([]byte, count*indexEntrySize)
+		footer  = make([]byte, footerSize)
+	)
+
+	for i, e := range index.Entries {
+		entry := entries[i*indexEntrySize:]
+
+		binary.BigEndian.PutUint64(entry[entryMsbOffset:], e.Msb)
+		binary.BigEndian.PutUint64(entry[entryLsbOffset:], e.Lsb)
+		binary.BigEndian.PutUint32(entry[entryPositionOffset:], uint32(e.Position))
+		binary.BigEndian.PutUint32(entry[entrySizeOffset:], uint32(e.Size))
+		binary.BigEndian.PutUint32(entry[entryGenerationOffset:], uint32(e.Generation))
+		binary.BigEndian.PutUint32(entry[entryFullGenerationOffset:], uint32(e.FullGeneration))
+
+		if e.Compacted {
+			entry[entryCompactedOffset] = 1
+		}
+	}
+
+	binary.BigEndian.PutUint32(footer[footerChecksumOffset:], crc32.ChecksumIEEE(entries))
+	binary.BigEndian.PutUint32(footer[footerCountOffset:], uint32(count))
+	binary.BigEndian.PutUint32(footer[footerSizeOffset:], uint32(len(entries)+footerSize))
+	binary.BigEndian.PutUint32(footer[footerMagicOffset:], indexMagic)
+
+	n, err := w.Write(entries)
+
+	if err != nil {
+		return int64(n), err
+	}
+
+	m, err := w.Write(footer)
+
+	return int64(n + m), err
+}
+
+// Lookup returns the entry of the segment with the provided ID. The first call
+// builds a map of the entries by segment ID, which is reused by the following
+// calls. For this reason, the entries must not be modified once Lookup has been
+// called, and Lookup must not be called concurrently.
+func (index *Index) Lookup(msb, lsb uint64) (*Entry, bool) {
+	if index.byID == nil {
+		index.byID = make(map[[2]uint64]int, len(index.Entries))
+
+		for i, e := range index.Entries {
+			index.byID[[2]uint64{e.Msb, e.Lsb}] = i
+		}
+	}
+
+	i, ok := index.byID[[2]uint64{msb, lsb}]
+
+	if !ok {
+		return nil, false
+	}
+
+	return &index.Entries[i], true
+}
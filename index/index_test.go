@@ -0,0 +1,102 @@
+package index
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func testIndex() *Index {
+	return &Index{
+		Entries: []Entry{
+			{Msb: 1, Lsb: 2, Position: 512, Size: 100, Generation: 1, FullGeneration: 1, Compacted: true},
+			{Msb: 3, Lsb: 4, Position: 1024, Size: 200, Generation: 2, FullGeneration: 1},
+		},
+	}
+}
+
+func TestLookup(t *testing.T) {
+	idx := testIndex()
+	for i, want := range idx.Entries {
+		e, ok := idx.Lookup(want.Msb, want.Lsb)
+		if !ok {
+			t.Fatalf("entry %d not found", i)
+		}
+		if *e != want {
+			t.Fatalf("got %+v, want %+v", *e, want)
+		}
+	}
+	if _, ok := idx.Lookup(5, 6); ok {
+		t.Fatal("found a missing entry")
+	}
+	if !reflect.DeepEqual(idx.Entries, testIndex().Entries) {
+		t.Fatal("the lookup modified the entries")
+	}
+}
+
+func TestLookupAfterReadFrom(t *testing.T) {
+	var (
+		idx   = testIndex()
+		other = Index{Entries: []Entry{{Msb: 7, Lsb: 8}}}
+	)
+	if _, ok := idx.Lookup(7, 8); ok {
+		t.Fatal("found a missing entry")
+	}
+	if _, err := idx.ReadFrom(bytes.NewReader(write(t, &other))); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.Lookup(7, 8); !ok {
+		t.Fatal("entry not found after reading a new index")
+	}
+}
+
+func TestWriteToRoundTrip(t *testing.T) {
+	sample, err := ioutil.ReadFile("testdata/data00000a.tar.idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte
+	}{
+		{"sample", func(t *testing.T) []byte { return sample }},
+		{"constructed", func(t *testing.T) []byte { return write(t, testIndex()) }},
+		{"empty", func(t *testing.T) []byte { return write(t, &Index{}) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				data = test.data(t)
+				idx  Index
+			)
+			if _, err := idx.ReadFrom(bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			written := write(t, &idx)
+			if !bytes.Equal(written, data) {
+				t.Fatalf("got %x, want %x", written, data)
+			}
+			var read Index
+			if _, err := read.ReadFrom(bytes.NewReader(written)); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(read, idx) {
+				t.Fatalf("got %+v, want %+v", read, idx)
+			}
+		})
+	}
+}
+
+func write(t *testing.T, idx *Index) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	n, err := idx.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(b.Len()) {
+		t.Fatalf("got %d bytes written, want %d", n, b.Len())
+	}
+	return b.Bytes()
+}
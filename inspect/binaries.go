@@ -0,0 +1,415 @@
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/francescomari/sdb/binaries"
+)
+
+// BinariesView selects the references of an index of binary references to be
+// printed. If 'Parse' is true, the references are split into their blob ID and
+// length. If 'Flat' is true, every distinct reference is printed once, sorted,
+// and preceded by the number of segments referencing it if 'Count' is true.
+// Only the references containing 'Grep' are printed, if it is not empty. The
+// page selects the generations to print, or the distinct references if 'Flat'
+// is true. The generations are highlighted by 'Color' and the IDs of the
+// segments are printed in 'Notation' in text format.
+type BinariesView struct {
+	Page     Pager
+	Parse    bool
+	Flat     bool
+	Count    bool
+	Grep     string
+	Color    Palette
+	Notation Notation
+}
+
+func (v BinariesView) matches(r string) bool {
+	return strings.Contains(r, v.Grep)
+}
+
+// matchesGeneration returns true if a generation has at least one reference
+// matching 'Grep', or if 'Grep' is empty.
+func (v BinariesView) matchesGeneration(g binaries.Generation) bool {
+	if v.Grep == "" {
+		return true
+	}
+	for _, s := range g.Segments {
+		for _, r := range s.References {
+			if v.matches(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PrintBinaries returns a handler printing an index of binary references in
+// the specified format.
+func PrintBinaries(f Format, v BinariesView, w io.Writer) Handler {
+	switch f {
+	case FormatHex:
+		return PrintHexTo(w)
+	case FormatText:
+		if v.Flat {
+			return printFlatBinariesTo(v, w)
+		}
+		return PrintBinariesTo(v, w)
+	case FormatJSON:
+		return printBinariesEncodedTo(encodeJSON, v, w)
+	case FormatYAML:
+		return printBinariesEncodedTo(encodeYAML, v, w)
+	default:
+		return InvalidFormat()
+	}
+}
+
+// PrintBinariesTo returns a handler printing the references of an index of
+// binary references in text format, one per line, preceded by the generation
+// and the ID of the segment referencing them.
+func PrintBinariesTo(v BinariesView, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var bns binaries.Binaries
+		if _, err := Parse(bns.ReadFrom, r); err != nil {
+			return err
+		}
+		if v.Parse {
+			tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+			defer tw.Flush()
+			w = tw
+		}
+		i := 0
+		for _, g := range bns.Generations {
+			if !v.matchesGeneration(g) {
+				continue
+			}
+			if v.Page.Done(i) {
+				return nil
+			}
+			if v.Page.Accept(i) {
+				for _, s := range g.Segments {
+					for _, r := range s.References {
+						if !v.matches(r) {
+							continue
+						}
+						if v.Parse {
+							fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\n", v.Color.Generation(g.Generation), v.Color.Generation(g.FullGeneration), g.Compacted, v.Notation.SegmentID(s.Msb, s.Lsb), formatBlobReference(r))
+						} else {
+							fmt.Fprintf(w, "%s %s %v %s %s\n", v.Color.Generation(g.Generation), v.Color.Generation(g.FullGeneration), g.Compacted, v.Notation.SegmentID(s.Msb, s.Lsb), r)
+						}
+					}
+				}
+			}
+			i++
+		}
+		return nil
+	}
+}
+
+func printFlatBinariesTo(v BinariesView, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var bns binaries.Binaries
+		if _, err := Parse(bns.ReadFrom, r); err != nil {
+			return err
+		}
+		counts := make(map[string]int)
+		for _, g := range bns.Generations {
+			for _, s := range g.Segments {
+				seen := make(map[string]bool)
+				for _, r := range s.References {
+					if v.matches(r) && !seen[r] {
+						seen[r] = true
+						counts[r]++
+					}
+				}
+			}
+		}
+		refs := make([]string, 0, len(counts))
+		for r := range counts {
+			refs = append(refs, r)
+		}
+		sort.Strings(refs)
+		for i, r := range refs {
+			if v.Page.Done(i) {
+				break
+			}
+			if !v.Page.Accept(i) {
+				continue
+			}
+			if v.Count {
+				fmt.Fprintf(w, "%d %s\n", counts[r], r)
+			} else {
+				fmt.Fprintln(w, r)
+			}
+		}
+		return nil
+	}
+}
+
+var blobReferenceRegexp = regexp.MustCompile("^([0-9a-fA-F]+)#([0-9]+)$")
+
+// parseBlobReference splits a reference to an external binary into its blob ID
+// and its length. The reference must have the form 'id#length', where the ID
+// is hexadecimal and the length is decimal.
+func parseBlobReference(r string) (id string, length int64, err error) {
+	matches := blobReferenceRegexp.FindStringSubmatch(r)
+	if matches == nil {
+		return "", 0, fmt.Errorf("malformed binary reference '%s'", r)
+	}
+	length, err = strconv.ParseInt(matches[2], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed binary reference '%s'", r)
+	}
+	return matches[1], length, nil
+}
+
+// formatBlobReference returns the blob ID and the length of a reference as two
+// tab-separated columns. A malformed reference is returned as it is, prefixed
+// by '!', with an unknown length.
+func formatBlobReference(r string) string {
+	id, length, err := parseBlobReference(r)
+	if err != nil {
+		return "!" + r + "\t?"
+	}
+	return fmt.Sprintf("%s\t%d", id, length)
+}
+
+type jsonBinariesGeneration struct {
+	Generation     int                   `json:"generation" yaml:"generation"`
+	FullGeneration int                   `json:"fullGeneration" yaml:"fullGeneration"`
+	Compacted      bool                  `json:"compacted" yaml:"compacted"`
+	Segments       []jsonBinariesSegment `json:"segments" yaml:"segments"`
+}
+
+type jsonBinariesSegment struct {
+	ID         string   `json:"id" yaml:"id"`
+	References []string `json:"references" yaml:"references"`
+}
+
+// newJSONBinariesGeneration returns the segments of a generation and their
+// references matching 'Grep'. The segments without matching references are
+// omitted if 'Grep' is not empty.
+func newJSONBinariesGeneration(v BinariesView, g binaries.Generation) jsonBinariesGeneration {
+	ss := make([]jsonBinariesSegment, 0, len(g.Segments))
+	for _, s := range g.Segments {
+		rs := make([]string, 0, len(s.References))
+		for _, r := range s.References {
+			if v.matches(r) {
+				rs = append(rs, r)
+			}
+		}
+		if v.Grep != "" && len(rs) == 0 {
+			continue
+		}
+		ss = append(ss, jsonBinariesSegment{SegmentID(s.Msb, s.Lsb), rs})
+	}
+	return jsonBinariesGeneration{g.Generation, g.FullGeneration, g.Compacted, ss}
+}
+
+// printBinariesEncodedTo returns a handler printing an index of binary
+// references in a structured format. If 'Grep' is not empty, only the matching
+// references are printed, and the segments and generations without matching
+// references are omitted. The page selects the generations to print.
+func printBinariesEncodedTo(encode encoder, v BinariesView, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var bns binaries.Binaries
+		if _, err := Parse(bns.ReadFrom, r); err != nil {
+			return err
+		}
+		gs := make([]jsonBinariesGeneration, 0, len(bns.Generations))
+		i := 0
+		for _, g := range bns.Generations {
+			if !v.matchesGeneration(g) {
+				continue
+			}
+			if v.Page.Done(i) {
+				break
+			}
+			if v.Page.Accept(i) {
+				gs = append(gs, newJSONBinariesGeneration(v, g))
+			}
+			i++
+		}
+		return encode(w, gs)
+	}
+}
+
+// PrintBinariesByReference returns a handler printing every distinct reference
+// of an index of binary references together with the segments referencing it,
+// in any generation. The references are sorted by the number of segments
+// referencing them, in descending order.
+func PrintBinariesByReference(f Format, v BinariesView, w io.Writer) Handler {
+	switch f {
+	case FormatText:
+		return printBinariesByReferenceTo(v, w)
+	case FormatJSON:
+		return printBinariesByReferenceEncodedTo(encodeJSON, v, w)
+	case FormatYAML:
+		return printBinariesByReferenceEncodedTo(encodeYAML, v, w)
+	default:
+		return InvalidFormat()
+	}
+}
+
+// referencingSegments is a reference to a binary and the IDs of the segments
+// referencing it.
+type referencingSegments struct {
+	reference string
+	segments  []string
+}
+
+// readReferencingSegments inverts an index of binary references, keeping only
+// the references matched by 'v'. The segments of every reference are sorted by
+// ID. The references are sorted by the number of segments, in descending order,
+// and by reference when the number of segments is the same.
+func readReferencingSegments(v BinariesView, r io.Reader) ([]referencingSegments, error) {
+	var bns binaries.Binaries
+	if _, err := Parse(bns.ReadFrom, r); err != nil {
+		return nil, err
+	}
+	segments := make(map[string]map[string]bool)
+	for _, g := range bns.Generations {
+		for _, s := range g.Segments {
+			id := SegmentID(s.Msb, s.Lsb)
+			for _, r := range s.References {
+				if !v.matches(r) {
+					continue
+				}
+				if segments[r] == nil {
+					segments[r] = make(map[string]bool)
+				}
+				segments[r][id] = true
+			}
+		}
+	}
+	refs := make([]referencingSegments, 0, len(segments))
+	for r, ids := range segments {
+		rs := referencingSegments{reference: r}
+		for id := range ids {
+			rs.segments = append(rs.segments, id)
+		}
+		sort.Strings(rs.segments)
+		refs = append(refs, rs)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if len(refs[i].segments) != len(refs[j].segments) {
+			return len(refs[i].segments) > len(refs[j].segments)
+		}
+		return refs[i].reference < refs[j].reference
+	})
+	return refs, nil
+}
+
+// printBinariesByReferenceTo prints a line for every segment referencing a
+// reference, with the number of segments referencing it, the reference and the
+// ID of the segment.
+func printBinariesByReferenceTo(v BinariesView, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		refs, err := readReferencingSegments(v, r)
+		if err != nil {
+			return err
+		}
+		for i, rs := range refs {
+			if v.Page.Done(i) {
+				break
+			}
+			if !v.Page.Accept(i) {
+				continue
+			}
+			for _, id := range rs.segments {
+				msb, lsb := SegmentIDParts(id)
+				fmt.Fprintf(w, "%d %s %s\n", len(rs.segments), rs.reference, v.Notation.SegmentID(msb, lsb))
+			}
+		}
+		return nil
+	}
+}
+
+type jsonReferencingSegments struct {
+	Reference string   `json:"reference" yaml:"reference"`
+	Segments  []string `json:"segments" yaml:"segments"`
+}
+
+func printBinariesByReferenceEncodedTo(encode encoder, v BinariesView, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		refs, err := readReferencingSegments(v, r)
+		if err != nil {
+			return err
+		}
+		rs := make([]jsonReferencingSegments, 0, len(refs))
+		for i, ref := range refs {
+			if v.Page.Done(i) {
+				break
+			}
+			if v.Page.Accept(i) {
+				rs = append(rs, jsonReferencingSegments{ref.reference, ref.segments})
+			}
+		}
+		return encode(w, rs)
+	}
+}
+
+// PrintBinariesSummary returns a handler printing, for every generation of an
+// index of binary references, the number of segments and the total number of
+// references, instead of the references themselves.
+func PrintBinariesSummary(f Format, w io.Writer) Handler {
+	switch f {
+	case FormatText:
+		return printBinariesSummaryTo(w)
+	case FormatJSON:
+		return printBinariesSummaryEncodedTo(encodeJSON, w)
+	case FormatYAML:
+		return printBinariesSummaryEncodedTo(encodeYAML, w)
+	default:
+		return InvalidFormat()
+	}
+}
+
+func printBinariesSummaryTo(w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var bns binaries.Binaries
+		if _, err := Parse(bns.ReadFrom, r); err != nil {
+			return err
+		}
+		for _, g := range bns.Generations {
+			references := 0
+			for _, s := range g.Segments {
+				references += len(s.References)
+			}
+			fmt.Fprintf(w, "%d %d %v %d %d\n", g.Generation, g.FullGeneration, g.Compacted, len(g.Segments), references)
+		}
+		return nil
+	}
+}
+
+type jsonBinariesSummary struct {
+	Generation     int  `json:"generation" yaml:"generation"`
+	FullGeneration int  `json:"fullGeneration" yaml:"fullGeneration"`
+	Compacted      bool `json:"compacted" yaml:"compacted"`
+	Segments       int  `json:"segments" yaml:"segments"`
+	References     int  `json:"references" yaml:"references"`
+}
+
+func printBinariesSummaryEncodedTo(encode encoder, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var bns binaries.Binaries
+		if _, err := Parse(bns.ReadFrom, r); err != nil {
+			return err
+		}
+		gs := make([]jsonBinariesSummary, 0, len(bns.Generations))
+		for _, g := range bns.Generations {
+			references := 0
+			for _, s := range g.Segments {
+				references += len(s.References)
+			}
+			gs = append(gs, jsonBinariesSummary{g.Generation, g.FullGeneration, g.Compacted, len(g.Segments), references})
+		}
+		return encode(w, gs)
+	}
+}
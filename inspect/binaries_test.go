@@ -0,0 +1,170 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/francescomari/sdb/binaries"
+)
+
+// testBinariesData serializes the binary references of 'generations' in the
+// most recent format.
+func testBinariesData(generations ...binaries.Generation) []byte {
+	var b bytes.Buffer
+	for _, g := range generations {
+		binary.Write(&b, binary.BigEndian, uint32(g.Generation))
+		binary.Write(&b, binary.BigEndian, uint32(g.FullGeneration))
+		if g.Compacted {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+		binary.Write(&b, binary.BigEndian, uint32(len(g.Segments)))
+		for _, s := range g.Segments {
+			binary.Write(&b, binary.BigEndian, s.Msb)
+			binary.Write(&b, binary.BigEndian, s.Lsb)
+			binary.Write(&b, binary.BigEndian, uint32(len(s.References)))
+			for _, r := range s.References {
+				binary.Write(&b, binary.BigEndian, uint32(len(r)))
+				b.WriteString(r)
+			}
+		}
+	}
+	entries := b.Bytes()
+	footer := make([]byte, 16)
+	binary.BigEndian.PutUint32(footer[0:], crc32.ChecksumIEEE(entries))
+	binary.BigEndian.PutUint32(footer[4:], uint32(len(generations)))
+	binary.BigEndian.PutUint32(footer[8:], uint32(len(entries)+len(footer)))
+	binary.BigEndian.PutUint32(footer[12:], 0x0a31420a)
+	return append(entries, footer...)
+}
+
+// testSharedBinaries returns the binary references of two generations, where
+// the segments 'a' and 'b' share the reference "shared#10".
+func testSharedBinaries() []byte {
+	return testBinariesData(
+		binaries.Generation{Generation: 1, FullGeneration: 1, Compacted: true, Segments: []binaries.Segment{
+			{Msb: 0x1111111111114111, Lsb: 0xa111111111111111, References: []string{"shared#10", "aa#1"}},
+		}},
+		binaries.Generation{Generation: 2, FullGeneration: 2, Segments: []binaries.Segment{
+			{Msb: 0x2222222222224222, Lsb: 0xa222222222222222, References: []string{"shared#10"}},
+			{Msb: 0x3333333333334333, Lsb: 0xa333333333333333, References: []string{"bb#2", "cc#3", "dd#4"}},
+		}},
+	)
+}
+
+func TestPrintBinariesByReference(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{
+			format: FormatText,
+			want: "" +
+				"2 shared#10 1111111111114111a111111111111111\n" +
+				"2 shared#10 2222222222224222a222222222222222\n" +
+				"1 aa#1 1111111111114111a111111111111111\n" +
+				"1 bb#2 3333333333334333a333333333333333\n" +
+				"1 cc#3 3333333333334333a333333333333333\n" +
+				"1 dd#4 3333333333334333a333333333333333\n",
+		},
+		{
+			format: FormatJSON,
+			want: `[{"reference":"shared#10","segments":["1111111111114111a111111111111111","2222222222224222a222222222222222"]},` +
+				`{"reference":"aa#1","segments":["1111111111114111a111111111111111"]},` +
+				`{"reference":"bb#2","segments":["3333333333334333a333333333333333"]},` +
+				`{"reference":"cc#3","segments":["3333333333334333a333333333333333"]},` +
+				`{"reference":"dd#4","segments":["3333333333334333a333333333333333"]}]` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.format.String(), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := PrintBinariesByReference(test.format, BinariesView{Page: AllEntries()}, &b)("", bytes.NewReader(testSharedBinaries())); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != test.want {
+				t.Fatalf("got\n%s\nwant\n%s", b.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestPrintBinariesJSONRoundTrip(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/data00000a.tar.brf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want binaries.Binaries
+	if _, err := want.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := PrintBinaries(FormatJSON, BinariesView{Page: AllEntries()}, &b)("", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []jsonBinariesGeneration
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var got binaries.Binaries
+	for _, g := range decoded {
+		bg := binaries.Generation{Generation: g.Generation, FullGeneration: g.FullGeneration, Compacted: g.Compacted}
+		for _, s := range g.Segments {
+			msb, lsb := SegmentIDParts(s.ID)
+			bg.Segments = append(bg.Segments, binaries.Segment{Msb: msb, Lsb: lsb, References: s.References})
+		}
+		got.Generations = append(got.Generations, bg)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestFormatBlobReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"0123456789abcdef#1234", "0123456789abcdef\t1234"},
+		{"0123456789ABCDEF#0", "0123456789ABCDEF\t0"},
+		{"bad ref", "!bad ref\t?"},
+		{"0123#", "!0123#\t?"},
+		{"#12", "!#12\t?"},
+		{"xyz#12", "!xyz#12\t?"},
+		{"0123#99999999999999999999", "!0123#99999999999999999999\t?"},
+		{"", "!\t?"},
+	}
+	for _, test := range tests {
+		if got := formatBlobReference(test.ref); got != test.want {
+			t.Fatalf("%q: got %q, want %q", test.ref, got, test.want)
+		}
+	}
+}
+
+func TestPrintBinariesSummary(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatText, "1 1 true 1 2\n2 2 false 2 4\n"},
+		{FormatJSON, `[{"generation":1,"fullGeneration":1,"compacted":true,"segments":1,"references":2},` +
+			`{"generation":2,"fullGeneration":2,"compacted":false,"segments":2,"references":4}]` + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.format.String(), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := PrintBinariesSummary(test.format, &b)("", bytes.NewReader(testSharedBinaries())); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != test.want {
+				t.Fatalf("got\n%s\nwant\n%s", b.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package inspect
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/segment"
+)
+
+// An IndexFilter selects the entries of an index.
+type IndexFilter func(e index.Entry) bool
+
+// AllOf returns a filter accepting the entries accepted by every filter in
+// 'fs'.
+func AllOf(fs ...IndexFilter) IndexFilter {
+	return func(e index.Entry) bool {
+		for _, f := range fs {
+			if !f(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// An IDFilter selects segments by their normalized ID.
+type IDFilter func(id string) bool
+
+// AnyID accepts every segment.
+func AnyID(_ string) bool {
+	return true
+}
+
+// And returns a filter accepting the segments accepted by both 'f' and 'g'.
+func (f IDFilter) And(g IDFilter) IDFilter {
+	return func(id string) bool {
+		return f(id) && g(id)
+	}
+}
+
+// IndexFilter returns a filter accepting the index entries of the segments
+// accepted by 'f'.
+func (f IDFilter) IndexFilter() IndexFilter {
+	return func(e index.Entry) bool {
+		return f(SegmentID(e.Msb, e.Lsb))
+	}
+}
+
+// IndexSortKey is either empty or the name of the field the entries of an
+// index are sorted by.
+type IndexSortKey string
+
+const (
+	SortByID         IndexSortKey = "id"
+	SortByPosition   IndexSortKey = "position"
+	SortBySize       IndexSortKey = "size"
+	SortByGeneration IndexSortKey = "generation"
+)
+
+func (k *IndexSortKey) String() string {
+	return string(*k)
+}
+
+func (k *IndexSortKey) Set(s string) error {
+	switch IndexSortKey(s) {
+	case SortByID, SortByPosition, SortBySize, SortByGeneration:
+		*k = IndexSortKey(s)
+	default:
+		return fmt.Errorf("Invalid sort key '%s'", s)
+	}
+	return nil
+}
+
+func (k *IndexSortKey) Type() string {
+	return "key"
+}
+
+func (k IndexSortKey) less(a, b index.Entry) bool {
+	switch k {
+	case SortByID:
+		return a.Msb < b.Msb || a.Msb == b.Msb && a.Lsb < b.Lsb
+	case SortByPosition:
+		return a.Position < b.Position
+	case SortBySize:
+		return a.Size < b.Size
+	case SortByGeneration:
+		return a.Generation < b.Generation
+	default:
+		return false
+	}
+}
+
+// Pager selects a range of a sequence of entries. It skips the first 'Skip'
+// entries and accepts at most 'Limit' of the remaining ones, or all of them if
+// 'Limit' is negative.
+type Pager struct {
+	Skip  int
+	Limit int
+}
+
+// AllEntries returns a pager accepting every entry.
+func AllEntries() Pager {
+	return Pager{Limit: -1}
+}
+
+// Accept returns true if the entry at position 'i' in the sequence, starting
+// from zero, is in the range.
+func (p Pager) Accept(i int) bool {
+	return i >= p.Skip && !p.Done(i)
+}
+
+// Done returns true if the entry at position 'i' in the sequence, starting
+// from zero, and every entry after it are past the end of the range.
+func (p Pager) Done(i int) bool {
+	return p.Limit >= 0 && i >= p.Skip+p.Limit
+}
+
+// IndexView selects and orders the entries of an index before they are printed.
+// A nil 'Keep' selects every entry. Without a sort key, the entries are kept in
+// the order they are stored in the index. The page is applied after sorting. If
+// 'Human' is true, the sizes are printed in a human-readable format. If
+// 'IDsOnly' is true, only the IDs of the segments are printed. The types of the
+// segments are colored by 'Color' and the IDs are printed in 'Notation' in text
+// format.
+type IndexView struct {
+	Keep     IndexFilter
+	SortBy   IndexSortKey
+	Reverse  bool
+	Page     Pager
+	Human    bool
+	IDsOnly  bool
+	Color    Palette
+	Notation Notation
+}
+
+// Entries returns the entries of an index selected by the view, in the order
+// they are printed.
+func (v IndexView) Entries(idx *index.Index) []index.Entry {
+	var es []index.Entry
+	for _, e := range idx.Entries {
+		if v.Keep == nil || v.Keep(e) {
+			es = append(es, e)
+		}
+	}
+	if v.SortBy != "" {
+		sort.SliceStable(es, func(i, j int) bool {
+			if v.Reverse {
+				return v.SortBy.less(es[j], es[i])
+			}
+			return v.SortBy.less(es[i], es[j])
+		})
+	} else if v.Reverse {
+		for i, j := 0, len(es)-1; i < j; i, j = i+1, j-1 {
+			es[i], es[j] = es[j], es[i]
+		}
+	}
+	var paged []index.Entry
+	for i, e := range es {
+		if v.Page.Done(i) {
+			break
+		}
+		if v.Page.Accept(i) {
+			paged = append(paged, e)
+		}
+	}
+	return paged
+}
+
+// A RecordFilter selects the records of a segment.
+type RecordFilter func(r segment.Record) bool
+
+// AnyRecord accepts every record.
+func AnyRecord(_ segment.Record) bool {
+	return true
+}
+
+// RecordTypesFilter returns a filter accepting the records whose type has one of
+// the provided names, as returned by RecordType. If no name is provided, every
+// record is accepted.
+func RecordTypesFilter(names []string) (RecordFilter, error) {
+	if len(names) == 0 {
+		return AnyRecord, nil
+	}
+	valid := make(map[string]segment.RecordType)
+	for t := segment.RecordTypeMapLeaf; t <= segment.RecordTypeBlobID; t++ {
+		valid[RecordType(t)] = t
+	}
+	types := make(map[segment.RecordType]bool)
+	for _, name := range names {
+		t, ok := valid[name]
+		if !ok {
+			var all []string
+			for n := range valid {
+				all = append(all, n)
+			}
+			sort.Strings(all)
+			return nil, fmt.Errorf("invalid record type '%s', valid types are %s", name, strings.Join(all, ", "))
+		}
+		types[t] = true
+	}
+	return func(r segment.Record) bool {
+		return types[r.Type]
+	}, nil
+}
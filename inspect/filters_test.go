@@ -0,0 +1,155 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/francescomari/sdb/graph"
+	"github.com/francescomari/sdb/index"
+)
+
+func TestIndexViewSort(t *testing.T) {
+	idx := index.Index{Entries: []index.Entry{
+		{Msb: 3, Lsb: 0, Position: 0x200, Size: 300, Generation: 2},
+		{Msb: 1, Lsb: 0, Position: 0x600, Size: 100, Generation: 1},
+		{Msb: 4, Lsb: 0, Position: 0x400, Size: 300, Generation: 1},
+		{Msb: 2, Lsb: 0, Position: 0x800, Size: 200, Generation: 2},
+	}}
+	tests := []struct {
+		key     IndexSortKey
+		reverse bool
+		want    []uint64
+	}{
+		{"", false, []uint64{3, 1, 4, 2}},
+		{"", true, []uint64{2, 4, 1, 3}},
+		{SortByID, false, []uint64{1, 2, 3, 4}},
+		{SortByID, true, []uint64{4, 3, 2, 1}},
+		{SortByPosition, false, []uint64{3, 4, 1, 2}},
+		{SortByPosition, true, []uint64{2, 1, 4, 3}},
+		{SortBySize, false, []uint64{1, 2, 3, 4}},
+		{SortBySize, true, []uint64{3, 4, 2, 1}},
+		{SortByGeneration, false, []uint64{1, 4, 3, 2}},
+		{SortByGeneration, true, []uint64{3, 2, 1, 4}},
+	}
+	for _, test := range tests {
+		v := IndexView{Keep: AllOf(), SortBy: test.key, Reverse: test.reverse, Page: AllEntries()}
+		var got []uint64
+		for _, e := range v.Entries(&idx) {
+			got = append(got, e.Msb)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("sort by %q, reverse %v: got %v, want %v", test.key, test.reverse, got, test.want)
+		}
+	}
+}
+
+func TestIndexViewWithoutKeep(t *testing.T) {
+	idx := index.Index{Entries: []index.Entry{{Msb: 1}, {Msb: 2}}}
+	v := IndexView{Page: AllEntries()}
+	if got := v.Entries(&idx); !reflect.DeepEqual(got, idx.Entries) {
+		t.Fatalf("got %v, want %v", got, idx.Entries)
+	}
+}
+
+func TestIndexSortKeySet(t *testing.T) {
+	for _, s := range []string{"id", "position", "size", "generation"} {
+		var k IndexSortKey
+		if err := k.Set(s); err != nil || string(k) != s {
+			t.Fatalf("%q: got %q, error %v", s, k, err)
+		}
+	}
+	var k IndexSortKey
+	if err := k.Set("offset"); err == nil {
+		t.Fatal("an invalid sort key was accepted")
+	}
+}
+
+func TestIndexViewSortFilteredAndPaged(t *testing.T) {
+	idx := index.Index{Entries: []index.Entry{
+		{Msb: 1, Size: 400, Generation: 1},
+		{Msb: 2, Size: 100, Generation: 2},
+		{Msb: 3, Size: 300, Generation: 2},
+		{Msb: 4, Size: 300, Generation: 2},
+		{Msb: 5, Size: 200, Generation: 2},
+	}}
+	v := IndexView{
+		Keep:    func(e index.Entry) bool { return e.Generation == 2 },
+		SortBy:  SortBySize,
+		Reverse: true,
+		Page:    Pager{Skip: 1, Limit: 2},
+	}
+	var got []uint64
+	for _, e := range v.Entries(&idx) {
+		got = append(got, e.Msb)
+	}
+	if want := []uint64{4, 5}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	var (
+		idx = testIndexData(t,
+			index.Entry{Msb: 1, Lsb: 1, Size: 100},
+			index.Entry{Msb: 2, Lsb: 2, Size: 100},
+			index.Entry{Msb: 3, Lsb: 3, Size: 100},
+		)
+		gph bytes.Buffer
+		g   = graph.Graph{Entries: []graph.Entry{
+			{Msb: 1, Lsb: 1, References: []graph.Reference{{Msb: 2, Lsb: 2}, {Msb: 3, Lsb: 3}}},
+			{Msb: 2, Lsb: 2, References: []graph.Reference{{Msb: 3, Lsb: 3}, {Msb: 1, Lsb: 1}}},
+			{Msb: 3, Lsb: 3, References: []graph.Reference{{Msb: 1, Lsb: 1}, {Msb: 2, Lsb: 2}}},
+		}}
+	)
+	if _, err := g.WriteTo(&gph); err != nil {
+		t.Fatal(err)
+	}
+	handlers := []struct {
+		name  string
+		data  []byte
+		total int
+		h     func(p Pager, w *bytes.Buffer) Handler
+	}{
+		{"index", idx, 3, func(p Pager, w *bytes.Buffer) Handler {
+			return PrintIndex(FormatJSON, IndexView{Keep: AllOf(), Page: p}, w)
+		}},
+		{"graph", gph.Bytes(), 3, func(p Pager, w *bytes.Buffer) Handler {
+			return PrintGraph(FormatJSON, AnyID, p, Notation{}, w)
+		}},
+		{"binaries", testSharedBinaries(), 2, func(p Pager, w *bytes.Buffer) Handler {
+			return PrintBinaries(FormatJSON, BinariesView{Page: p}, w)
+		}},
+	}
+	for _, h := range handlers {
+		for limit := 0; limit <= h.total+1; limit++ {
+			var b bytes.Buffer
+			if err := h.h(Pager{Limit: limit}, &b)("", bytes.NewReader(h.data)); err != nil {
+				t.Fatalf("%s, limit %d: %v", h.name, limit, err)
+			}
+			var items []json.RawMessage
+			if err := json.Unmarshal(b.Bytes(), &items); err != nil {
+				t.Fatalf("%s, limit %d: %v", h.name, limit, err)
+			}
+			want := limit
+			if want > h.total {
+				want = h.total
+			}
+			if len(items) != want {
+				t.Fatalf("%s, limit %d: got %d items, want %d", h.name, limit, len(items), want)
+			}
+		}
+	}
+	// The limit applies to the entries of the graph, not to their references.
+	var b bytes.Buffer
+	if err := PrintGraphTo(AnyID, Pager{Limit: 1}, Notation{}, &b)("", bytes.NewReader(gph.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"00000000000000010000000000000001 00000000000000020000000000000002\n" +
+		"00000000000000010000000000000001 00000000000000030000000000000003\n"
+	if b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
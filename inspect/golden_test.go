@@ -0,0 +1,130 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata")
+
+func TestGoldenJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		h     func(w *bytes.Buffer) Handler
+	}{
+		{
+			name:  "index",
+			entry: "data00000a.tar.idx",
+			h: func(w *bytes.Buffer) Handler {
+				return PrintIndex(FormatJSON, IndexView{Keep: AllOf(), Page: AllEntries()}, w)
+			},
+		},
+		{
+			name:  "graph",
+			entry: "data00000a.tar.gph",
+			h: func(w *bytes.Buffer) Handler {
+				return PrintGraph(FormatJSON, AnyID, AllEntries(), Notation{}, w)
+			},
+		},
+		{
+			name:  "binaries",
+			entry: "data00000a.tar.brf",
+			h: func(w *bytes.Buffer) Handler {
+				return PrintBinaries(FormatJSON, BinariesView{Page: AllEntries()}, w)
+			},
+		},
+		{
+			name:  "segment",
+			entry: "11111111-1111-4111-a111-111111111111.099d4b09",
+			h: func(w *bytes.Buffer) Handler {
+				return PrintSegment(FormatJSON, SegmentView{Keep: AnyRecord, Sizes: true, Decode: true, MaxLength: -1, ResolveRefs: true}, w)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", test.entry))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var got bytes.Buffer
+			if err := test.h(&got)(test.entry, f); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", test.name+".json")
+			if *update {
+				if err := ioutil.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Fatalf("got\n%s\nwant\n%s", got.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestYAMLMatchesJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		h     func(f Format, w *bytes.Buffer) Handler
+		value func() interface{}
+	}{
+		{
+			name:  "index",
+			entry: "data00000a.tar.idx",
+			h: func(f Format, w *bytes.Buffer) Handler {
+				return PrintIndex(f, IndexView{Keep: AllOf(), Page: AllEntries()}, w)
+			},
+			value: func() interface{} { return new([]jsonIndexEntry) },
+		},
+		{
+			name:  "segment",
+			entry: "11111111-1111-4111-a111-111111111111.099d4b09",
+			h: func(f Format, w *bytes.Buffer) Handler {
+				return PrintSegment(f, SegmentView{Keep: AnyRecord, Sizes: true, Decode: true, MaxLength: -1, ResolveRefs: true}, w)
+			},
+			value: func() interface{} { return new(jsonSegment) },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", test.entry))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var jsonOut, yamlOut bytes.Buffer
+			if err := test.h(FormatJSON, &jsonOut)(test.entry, bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			if err := test.h(FormatYAML, &yamlOut)(test.entry, bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			fromJSON, fromYAML := test.value(), test.value()
+			if err := json.Unmarshal(jsonOut.Bytes(), fromJSON); err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal(yamlOut.Bytes(), fromYAML); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fromYAML, fromJSON) {
+				t.Fatalf("got %+v, want %+v", fromYAML, fromJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package inspect
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/francescomari/sdb/graph"
+)
+
+// PrintGraph returns a handler printing the references of the segments
+// accepted by 'keep' in the specified format. The page selects the segments
+// whose references are printed, in every format except dot. Except for the hex
+// format, the graph is parsed before anything is written, so nothing is
+// written to 'w' if the graph is truncated or corrupted.
+func PrintGraph(f Format, keep IDFilter, p Pager, n Notation, w io.Writer) Handler {
+	switch f {
+	case FormatHex:
+		return PrintHexTo(w)
+	case FormatText:
+		return PrintGraphTo(keep, p, n, w)
+	case FormatJSON:
+		return printGraphEncodedTo(keep, p, encodeJSON, w)
+	case FormatYAML:
+		return printGraphEncodedTo(keep, p, encodeYAML, w)
+	case FormatDot:
+		return printGraphDotTo(keep, w)
+	default:
+		return InvalidFormat()
+	}
+}
+
+// PrintGraphTo returns a handler printing a graph in text format, one
+// reference per line, preceded by the ID of the segment it belongs to.
+func PrintGraphTo(keep IDFilter, p Pager, n Notation, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		i := 0
+		for _, e := range gph.Entries {
+			if !keep(SegmentID(e.Msb, e.Lsb)) {
+				continue
+			}
+			if p.Done(i) {
+				return nil
+			}
+			if p.Accept(i) {
+				for _, r := range e.References {
+					fmt.Fprintf(w, "%s %s\n", n.SegmentID(e.Msb, e.Lsb), n.SegmentID(r.Msb, r.Lsb))
+				}
+			}
+			i++
+		}
+		return nil
+	}
+}
+
+type jsonGraphEntry struct {
+	ID         string   `json:"id" yaml:"id"`
+	References []string `json:"references" yaml:"references"`
+}
+
+func printGraphEncodedTo(keep IDFilter, p Pager, encode encoder, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		es := make([]jsonGraphEntry, 0, len(gph.Entries))
+		i := 0
+		for _, e := range gph.Entries {
+			if !keep(SegmentID(e.Msb, e.Lsb)) {
+				continue
+			}
+			if p.Done(i) {
+				break
+			}
+			if p.Accept(i) {
+				rs := make([]string, 0, len(e.References))
+				for _, r := range e.References {
+					rs = append(rs, SegmentID(r.Msb, r.Lsb))
+				}
+				es = append(es, jsonGraphEntry{SegmentID(e.Msb, e.Lsb), rs})
+			}
+			i++
+		}
+		return encode(w, es)
+	}
+}
+
+func printGraphDotTo(keep IDFilter, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var gph graph.Graph
+		if _, err := Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		var (
+			nodes     []string
+			edges     [][2]string
+			seenNodes = make(map[string]bool)
+			seenEdges = make(map[[2]string]bool)
+		)
+		addNode := func(id string) {
+			if !seenNodes[id] {
+				seenNodes[id] = true
+				nodes = append(nodes, id)
+			}
+		}
+		for _, e := range gph.Entries {
+			from := SegmentID(e.Msb, e.Lsb)
+			if !keep(from) {
+				continue
+			}
+			addNode(from)
+			for _, r := range e.References {
+				to := SegmentID(r.Msb, r.Lsb)
+				addNode(to)
+				if edge := [2]string{from, to}; !seenEdges[edge] {
+					seenEdges[edge] = true
+					edges = append(edges, edge)
+				}
+			}
+		}
+		fmt.Fprintln(w, "digraph {")
+		for _, id := range nodes {
+			fmt.Fprintf(w, "\t\"%s\" [label=\"%s\", %s];\n", id, id[:8], dotNodeStyle(id))
+		}
+		for _, e := range edges {
+			fmt.Fprintf(w, "\t\"%s\" -> \"%s\";\n", e[0], e[1])
+		}
+		fmt.Fprintln(w, "}")
+		return nil
+	}
+}
+
+func dotNodeStyle(id string) string {
+	if IsBulkSegmentID(id) {
+		return "shape=box, color=red"
+	}
+	return "shape=ellipse, color=blue"
+}
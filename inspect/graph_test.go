@@ -0,0 +1,152 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/francescomari/sdb/graph"
+)
+
+func testGraphData(t *testing.T) []byte {
+	t.Helper()
+	g := graph.Graph{
+		Entries: []graph.Entry{
+			{Msb: 1, Lsb: 2, References: []graph.Reference{{Msb: 3, Lsb: 4}}},
+			{Msb: 3, Lsb: 4, References: []graph.Reference{{Msb: 1, Lsb: 2}}},
+		},
+	}
+	var b bytes.Buffer
+	if _, err := g.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestPrintTruncatedGraph(t *testing.T) {
+	data := testGraphData(t)
+	var out bytes.Buffer
+	err := PrintGraphTo(AnyID, AllEntries(), Notation{}, &out)("data00000a.tar.gph", bytes.NewReader(data[:len(data)-1]))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("got error %v, want a parse error", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+}
+
+func TestPrintCorruptedGraph(t *testing.T) {
+	data := testGraphData(t)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"footer only", data[len(data)-16:]},
+		{"missing first byte", data[1:]},
+		{"missing last byte", data[:len(data)-1]},
+		{"invalid checksum", append([]byte{data[0] ^ 0xff}, data[1:]...)},
+	}
+	for _, f := range []Format{FormatText, FormatJSON, FormatYAML, FormatDot} {
+		for _, test := range tests {
+			t.Run(f.String()+" "+test.name, func(t *testing.T) {
+				h := PrintGraph(f, AnyID, AllEntries(), Notation{}, &bytes.Buffer{})
+				if err := h("data00000a.tar.gph", bytes.NewReader(test.data)); err == nil {
+					t.Fatal("expected an error")
+				}
+			})
+		}
+	}
+}
+
+func TestPrintGraphJSONRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+	if err := PrintGraph(FormatJSON, AnyID, AllEntries(), Notation{}, &b)("", bytes.NewReader(testGraphData(t))); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []jsonGraphEntry
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var got graph.Graph
+	for _, e := range decoded {
+		msb, lsb := SegmentIDParts(e.ID)
+		ge := graph.Entry{Msb: msb, Lsb: lsb}
+		for _, r := range e.References {
+			msb, lsb := SegmentIDParts(r)
+			ge.References = append(ge.References, graph.Reference{Msb: msb, Lsb: lsb})
+		}
+		got.Entries = append(got.Entries, ge)
+	}
+	var want graph.Graph
+	if _, err := want.ReadFrom(bytes.NewReader(testGraphData(t))); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestPrintGraphDot(t *testing.T) {
+	var (
+		a = graph.Reference{Msb: 0x1111111111114111, Lsb: 0xa111111111111111}
+		b = graph.Reference{Msb: 0x2222222222224222, Lsb: 0xa222222222222222}
+		c = graph.Reference{Msb: 0x3333333333334333, Lsb: 0xb333333333333333}
+		g = graph.Graph{Entries: []graph.Entry{
+			{Msb: a.Msb, Lsb: a.Lsb, References: []graph.Reference{b, c}},
+			{Msb: b.Msb, Lsb: b.Lsb, References: []graph.Reference{a, c}},
+		}}
+		data bytes.Buffer
+	)
+	if _, err := g.WriteTo(&data); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := PrintGraph(FormatDot, AnyID, AllEntries(), Notation{}, &out)("", &data); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if lines[0] != "digraph {" || lines[len(lines)-1] != "}" {
+		t.Fatalf("not a digraph:\n%s", out.String())
+	}
+	var (
+		nodeRegexp = regexp.MustCompile(`^\t"([0-9a-f]{32})" \[label="[0-9a-f]{8}", shape=(\w+), color=\w+\];$`)
+		edgeRegexp = regexp.MustCompile(`^\t"([0-9a-f]{32})" -> "([0-9a-f]{32})";$`)
+		shapes     = make(map[string]string)
+		edges      = make(map[[2]string]int)
+	)
+	for _, line := range lines[1 : len(lines)-1] {
+		if m := nodeRegexp.FindStringSubmatch(line); m != nil {
+			if _, ok := shapes[m[1]]; ok {
+				t.Fatalf("duplicate node %s", m[1])
+			}
+			shapes[m[1]] = m[2]
+		} else if m := edgeRegexp.FindStringSubmatch(line); m != nil {
+			edges[[2]string{m[1], m[2]}]++
+		} else {
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+	wantShapes := map[string]string{
+		SegmentID(a.Msb, a.Lsb): "ellipse",
+		SegmentID(b.Msb, b.Lsb): "ellipse",
+		SegmentID(c.Msb, c.Lsb): "box",
+	}
+	if !reflect.DeepEqual(shapes, wantShapes) {
+		t.Fatalf("got nodes %v, want %v", shapes, wantShapes)
+	}
+	wantEdges := make(map[[2]string]int)
+	for _, e := range g.Entries {
+		for _, r := range e.References {
+			wantEdges[[2]string{SegmentID(e.Msb, e.Lsb), SegmentID(r.Msb, r.Lsb)}]++
+		}
+	}
+	if !reflect.DeepEqual(edges, wantEdges) {
+		t.Fatalf("got edges %v, want %v", edges, wantEdges)
+	}
+}
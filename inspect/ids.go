@@ -0,0 +1,102 @@
+package inspect
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/francescomari/sdb/segment"
+)
+
+var segmentIDRegexp = regexp.MustCompile("^[0-9a-f]{32}$")
+
+// SegmentID formats the most and least significant bits of a segment ID as 32
+// lowercase hexadecimal digits.
+func SegmentID(msb, lsb uint64) string {
+	return fmt.Sprintf("%016x%016x", msb, lsb)
+}
+
+// NormalizeSegmentID removes dashes and surrounding spaces from a segment ID,
+// and converts it to lower case.
+func NormalizeSegmentID(id string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Replace(id, "-", "", -1)))
+}
+
+// ParseSegmentID normalizes a segment ID provided by the user, so that IDs can
+// be specified in upper case, with dashes or with surrounding spaces. The
+// normalized ID must consist of exactly 32 hexadecimal digits.
+func ParseSegmentID(s string) (string, error) {
+	id := NormalizeSegmentID(s)
+	if !segmentIDRegexp.MatchString(id) {
+		return "", fmt.Errorf("malformed segment id '%s', expected 32 hexadecimal digits", s)
+	}
+	return id, nil
+}
+
+// CheckSegmentID returns an error if 'id' is not a normalized segment ID.
+func CheckSegmentID(id string) error {
+	if !segmentIDRegexp.MatchString(id) {
+		return fmt.Errorf("malformed segment id '%s'", id)
+	}
+	return nil
+}
+
+// SegmentIDParts returns the most and least significant bits of a well-formed
+// segment ID, as returned by ParseSegmentID.
+func SegmentIDParts(id string) (msb, lsb uint64) {
+	msb, _ = strconv.ParseUint(id[:16], 16, 64)
+	lsb, _ = strconv.ParseUint(id[16:], 16, 64)
+	return msb, lsb
+}
+
+// IsBulkSegmentID returns true if 'id' is the normalized ID of a bulk segment.
+func IsBulkSegmentID(id string) bool {
+	return len(id) > 16 && id[16] == 'b'
+}
+
+// SegmentType returns the type of the segment with the normalized ID 'id',
+// either "bulk" or "data".
+func SegmentType(id string) string {
+	if IsBulkSegmentID(id) {
+		return "bulk"
+	}
+	return "data"
+}
+
+// RecordType returns the name of a record type, as printed in text format.
+func RecordType(t segment.RecordType) string {
+	switch t {
+	case segment.RecordTypeBlock:
+		return "block"
+	case segment.RecordTypeList:
+		return "list"
+	case segment.RecordTypeListBucket:
+		return "bucket"
+	case segment.RecordTypeMapBranch:
+		return "branch"
+	case segment.RecordTypeMapLeaf:
+		return "leaf"
+	case segment.RecordTypeNode:
+		return "node"
+	case segment.RecordTypeTemplate:
+		return "template"
+	case segment.RecordTypeValue:
+		return "value"
+	case segment.RecordTypeBlobID:
+		return "binary"
+	default:
+		return "unknown"
+	}
+}
+
+// EntrySegmentID returns the normalized ID of the segment stored in the entry
+// of a TAR file with the specified name. The checksum following the first '.'
+// is removed, if any. Names that don't identify a segment are normalized like
+// segment IDs, so the result never matches a well-formed ID.
+func EntrySegmentID(name string) string {
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	return NormalizeSegmentID(name)
+}
@@ -0,0 +1,71 @@
+package inspect
+
+import "testing"
+
+func TestEntrySegmentID(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"11111111-1111-4111-a111-111111111111.0123abcd", "1111111111114111a111111111111111"},
+		{"11111111-1111-4111-A111-111111111111.0123abcd", "1111111111114111a111111111111111"},
+		{"11111111-1111-4111-a111-111111111111", "1111111111114111a111111111111111"},
+		{"data00000a.tar.idx", "data00000a"},
+		{"unknown", "unknown"},
+		{"", ""},
+		{".", ""},
+	}
+	for _, test := range tests {
+		if got := EntrySegmentID(test.name); got != test.want {
+			t.Fatalf("%q: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsBulkSegmentID(t *testing.T) {
+	tests := []struct {
+		id   string
+		bulk bool
+		typ  string
+	}{
+		{"", false, "data"},
+		{"1111111111114111", false, "data"},
+		{"1111111111114111b", true, "bulk"},
+		{"1111111111114111a111111111111111", false, "data"},
+		{"2222222222224222b222222222222222", true, "bulk"},
+	}
+	for _, test := range tests {
+		if got := IsBulkSegmentID(test.id); got != test.bulk {
+			t.Fatalf("%q: got bulk %v, want %v", test.id, got, test.bulk)
+		}
+		if got := SegmentType(test.id); got != test.typ {
+			t.Fatalf("%q: got type %q, want %q", test.id, got, test.typ)
+		}
+	}
+}
+
+func TestParseSegmentID(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", true},
+		{"1111111111114111", "", true},
+		{"xyz", "", true},
+		{"1111111111114111a11111111111111g", "", true},
+		{"1111111111114111a111111111111111", "1111111111114111a111111111111111", false},
+		{"11111111-1111-4111-a111-111111111111", "1111111111114111a111111111111111", false},
+		{"11111111-1111-4111-A111-111111111111", "1111111111114111a111111111111111", false},
+		{" 1111111111114111A111111111111111 ", "1111111111114111a111111111111111", false},
+	}
+	for _, test := range tests {
+		got, err := ParseSegmentID(test.id)
+		if (err != nil) != test.wantErr {
+			t.Fatalf("%q: got error %v, want error %v", test.id, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Fatalf("%q: got %q, want %q", test.id, got, test.want)
+		}
+	}
+}
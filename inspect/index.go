@@ -0,0 +1,182 @@
+package inspect
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/francescomari/sdb/index"
+)
+
+// PrintIndex returns a handler printing an index in the specified format.
+func PrintIndex(f Format, v IndexView, w io.Writer) Handler {
+	switch f {
+	case FormatHex:
+		return PrintHexTo(w)
+	case FormatText:
+		return PrintIndexTo(v, w)
+	case FormatJSON:
+		return printIndexEncodedTo(v, encodeJSON, w)
+	case FormatYAML:
+		return printIndexEncodedTo(v, encodeYAML, w)
+	case FormatCSV:
+		return printIndexCSVTo(v, w)
+	default:
+		return InvalidFormat()
+	}
+}
+
+// PrintIndexTo returns a handler printing an index in text format, one entry
+// per line, or only the ID of the segment of every entry if 'IDsOnly' is true.
+// The numeric columns are right-aligned, and as wide as their widest value.
+func PrintIndexTo(v IndexView, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var idx index.Index
+		if _, err := Parse(idx.ReadFrom, r); err != nil {
+			return err
+		}
+		es := v.Entries(&idx)
+		if v.IDsOnly {
+			for _, e := range es {
+				fmt.Fprintln(w, v.Notation.SegmentID(e.Msb, e.Lsb))
+			}
+			return nil
+		}
+		var (
+			columns = make([][4]string, len(es))
+			widths  [4]int
+		)
+		for i, e := range es {
+			size := strconv.Itoa(e.Size)
+			if v.Human {
+				size = HumanSize(e.Size)
+			}
+			columns[i] = [4]string{v.Notation.Hex(e.Position), size, strconv.Itoa(e.Generation), strconv.Itoa(e.FullGeneration)}
+			for j, c := range columns[i] {
+				if len(c) > widths[j] {
+					widths[j] = len(c)
+				}
+			}
+		}
+		for i, e := range es {
+			var (
+				id = SegmentID(e.Msb, e.Lsb)
+				c  = columns[i]
+			)
+			fmt.Fprintf(w, "%s %s %*s %*s %*s %*s %v\n", v.Color.SegmentType(id), v.Notation.SegmentID(e.Msb, e.Lsb), widths[0], c[0], widths[1], c[1], widths[2], c[2], widths[3], c[3], e.Compacted)
+		}
+		return nil
+	}
+}
+
+// HumanSize formats a size in bytes using binary multiples and one decimal
+// digit, e.g. 1.5K or 12.0M. Sizes smaller than 1K are printed as they are.
+func HumanSize(n int) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return strconv.Itoa(n)
+	}
+	v := float64(n) / 1024
+	u := 0
+	// Move to the next unit if rounding to one decimal digit would print 1024.
+	for v >= 1023.95 && u < len(units)-1 {
+		v /= 1024
+		u++
+	}
+	return fmt.Sprintf("%.1f%c", v, units[u])
+}
+
+type jsonIndexEntry struct {
+	Type           string `json:"type" yaml:"type"`
+	ID             string `json:"id" yaml:"id"`
+	Position       int    `json:"position" yaml:"position"`
+	Size           int    `json:"size" yaml:"size"`
+	Generation     int    `json:"generation" yaml:"generation"`
+	FullGeneration int    `json:"fullGeneration" yaml:"fullGeneration"`
+	Compacted      bool   `json:"compacted" yaml:"compacted"`
+}
+
+func printIndexEncodedTo(v IndexView, encode encoder, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var idx index.Index
+		if _, err := Parse(idx.ReadFrom, r); err != nil {
+			return err
+		}
+		es := []jsonIndexEntry{}
+		for _, e := range v.Entries(&idx) {
+			id := SegmentID(e.Msb, e.Lsb)
+			es = append(es, jsonIndexEntry{SegmentType(id), id, e.Position, e.Size, e.Generation, e.FullGeneration, e.Compacted})
+		}
+		return encode(w, es)
+	}
+}
+
+func printIndexCSVTo(v IndexView, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		var idx index.Index
+		if _, err := Parse(idx.ReadFrom, r); err != nil {
+			return err
+		}
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"type", "id", "position", "size", "generation"})
+		for _, e := range v.Entries(&idx) {
+			id := SegmentID(e.Msb, e.Lsb)
+			cw.Write([]string{SegmentType(id), id, strconv.Itoa(e.Position), strconv.Itoa(e.Size), strconv.Itoa(e.Generation)})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+// Lookup returns a handler printing the entry of an index for the segment with
+// the normalized ID 'id', in text or JSON format. The handler fails if the
+// segment is not in the index. The ID and the position of the entry are
+// printed in 'n' in text format.
+func Lookup(f Format, id string, n Notation, w io.Writer) Handler {
+	switch f {
+	case FormatText:
+		return lookupTo(id, n, w)
+	case FormatJSON:
+		return lookupJSONTo(id, w)
+	default:
+		return InvalidFormat()
+	}
+}
+
+// lookupEntry returns the entry of the index for the segment with the
+// specified ID, or an error if the segment is not in the index.
+func lookupEntry(r io.Reader, id string) (index.Entry, error) {
+	var idx index.Index
+	if _, err := Parse(idx.ReadFrom, r); err != nil {
+		return index.Entry{}, err
+	}
+	msb, lsb := SegmentIDParts(id)
+	e, ok := idx.Lookup(msb, lsb)
+	if !ok {
+		return index.Entry{}, fmt.Errorf("segment %s not found", id)
+	}
+	return *e, nil
+}
+
+func lookupTo(id string, n Notation, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		e, err := lookupEntry(r, id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s %s %s %d %d %d %v\n", SegmentType(id), n.ID(id), n.Hex(e.Position), e.Size, e.Generation, e.FullGeneration, e.Compacted)
+		return nil
+	}
+}
+
+func lookupJSONTo(id string, w io.Writer) Handler {
+	return func(_ string, r io.Reader) error {
+		e, err := lookupEntry(r, id)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(jsonIndexEntry{SegmentType(id), id, e.Position, e.Size, e.Generation, e.FullGeneration, e.Compacted})
+	}
+}
@@ -0,0 +1,142 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/francescomari/sdb/index"
+)
+
+func testIndexData(t *testing.T, entries ...index.Entry) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if _, err := (&index.Index{Entries: entries}).WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// fieldEnds returns the offsets where the fields of 'line', separated by one
+// or more spaces, end.
+func fieldEnds(line string) []int {
+	var ends []int
+	for i := range line {
+		if line[i] != ' ' && (i == len(line)-1 || line[i+1] == ' ') {
+			ends = append(ends, i)
+		}
+	}
+	return ends
+}
+
+func TestPrintIndexAligned(t *testing.T) {
+	data := testIndexData(t,
+		index.Entry{Msb: 0x1111111111114111, Lsb: 0xa111111111111111, Position: 0x200, Size: 100, Generation: 1, FullGeneration: 1, Compacted: true},
+		index.Entry{Msb: 0x2222222222224222, Lsb: 0xa222222222222222, Position: 0x400, Size: 1500000, Generation: 12, FullGeneration: 12, Compacted: true},
+		index.Entry{Msb: 0x3333333333334333, Lsb: 0xb333333333333333, Position: 0x16e600, Size: 262144, Generation: 3, FullGeneration: 103, Compacted: true},
+	)
+	for _, human := range []bool{false, true} {
+		var b bytes.Buffer
+		v := IndexView{Keep: AllOf(), Page: AllEntries(), Human: human}
+		if err := PrintIndexTo(v, &b)("data00000a.tar.idx", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("got %d lines, want 3", len(lines))
+		}
+		if !human && !strings.Contains(lines[1], " 1500000 ") {
+			t.Fatalf("missing size in %q", lines[1])
+		}
+		want := fieldEnds(lines[0])
+		for _, line := range lines[1:] {
+			if got := fieldEnds(line); !reflect.DeepEqual(got, want) {
+				t.Fatalf("human %v: misaligned columns:\n%s", human, b.String())
+			}
+		}
+	}
+}
+
+func TestPrintIndexJSONRoundTrip(t *testing.T) {
+	entries := []index.Entry{
+		{Msb: 0x1111111111114111, Lsb: 0xa111111111111111, Position: 0x200, Size: 100, Generation: 1, FullGeneration: 1, Compacted: true},
+		{Msb: 0x3333333333334333, Lsb: 0xb333333333333333, Position: 0x400, Size: 262144, Generation: 3, FullGeneration: 103},
+	}
+	var b bytes.Buffer
+	if err := PrintIndex(FormatJSON, IndexView{Keep: AllOf(), Page: AllEntries()}, &b)("", bytes.NewReader(testIndexData(t, entries...))); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []jsonIndexEntry
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var got []index.Entry
+	for _, e := range decoded {
+		msb, lsb := SegmentIDParts(e.ID)
+		got = append(got, index.Entry{Msb: msb, Lsb: lsb, Position: e.Position, Size: e.Size, Generation: e.Generation, FullGeneration: e.FullGeneration, Compacted: e.Compacted})
+		if e.Type != SegmentType(e.ID) {
+			t.Fatalf("got type %q for %s", e.Type, e.ID)
+		}
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Fatalf("got %v, want %v", got, entries)
+	}
+}
+
+func TestPrintIndexCSV(t *testing.T) {
+	data := testIndexData(t,
+		index.Entry{Msb: 0x1111111111114111, Lsb: 0xa111111111111111, Position: 0x200, Size: 100, Generation: 1, FullGeneration: 1, Compacted: true},
+		index.Entry{Msb: 0x3333333333334333, Lsb: 0xb333333333333333, Position: 0x16e600, Size: 262144, Generation: 12, FullGeneration: 12},
+	)
+	var b bytes.Buffer
+	if err := PrintIndex(FormatCSV, IndexView{Keep: AllOf(), Page: AllEntries()}, &b)("", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"type,id,position,size,generation\n" +
+		"data,1111111111114111a111111111111111,512,100,1\n" +
+		"bulk,3333333333334333b333333333333333,1500672,262144,12\n"
+	if b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	data := testIndexData(t,
+		index.Entry{Msb: 0x1111111111114111, Lsb: 0xa111111111111111, Position: 0x200, Size: 100, Generation: 1, FullGeneration: 1, Compacted: true},
+		index.Entry{Msb: 0x3333333333334333, Lsb: 0xb333333333333333, Position: 0x400, Size: 262144, Generation: 3, FullGeneration: 103},
+	)
+	tests := []struct {
+		name    string
+		id      string
+		format  Format
+		want    string
+		wantErr bool
+	}{
+		{"present", "3333333333334333b333333333333333", FormatText, "bulk 3333333333334333b333333333333333 400 262144 3 103 false\n", false},
+		{"dashed upper case", "11111111-1111-4111-A111-111111111111", FormatText, "data 1111111111114111a111111111111111 200 100 1 1 true\n", false},
+		{"json", "1111111111114111a111111111111111", FormatJSON, `{"type":"data","id":"1111111111114111a111111111111111","position":512,"size":100,"generation":1,"fullGeneration":1,"compacted":true}` + "\n", false},
+		{"absent", "2222222222224222a222222222222222", FormatText, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := ParseSegmentID(test.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b bytes.Buffer
+			err = Lookup(test.format, id, Notation{}, &b)("", bytes.NewReader(data))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "not found") {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if b.String() != test.want {
+				t.Fatalf("got %q, want %q", b.String(), test.want)
+			}
+		})
+	}
+}
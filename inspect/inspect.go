@@ -0,0 +1,128 @@
+// Package inspect prints the content of the index, the graph, the index of
+// binary references and the segments of the TAR files of a segment store.
+// Every printer is a Handler, reading an entry of a TAR file from an io.Reader
+// and writing to an io.Writer.
+package inspect
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// A Handler processes the content of the entry of a TAR file with the
+// specified name.
+type Handler func(n string, r io.Reader) error
+
+// Format is the format of the output of a handler. It implements the Value
+// interface of the flag packages.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatHex  Format = "hex"
+	FormatJSON Format = "json"
+	FormatCSV  Format = "csv"
+	FormatDot  Format = "dot"
+	FormatYAML Format = "yaml"
+)
+
+func (f *Format) String() string {
+	return string(*f)
+}
+
+func (f *Format) Set(s string) error {
+	switch Format(s) {
+	case FormatHex:
+		*f = FormatHex
+	case FormatText:
+		*f = FormatText
+	case FormatJSON:
+		*f = FormatJSON
+	case FormatCSV:
+		*f = FormatCSV
+	case FormatDot:
+		*f = FormatDot
+	case FormatYAML:
+		*f = FormatYAML
+	default:
+		return fmt.Errorf("Invalid format '%s'", s)
+	}
+	return nil
+}
+
+func (f *Format) Type() string {
+	return "format"
+}
+
+// ErrInvalidFormat is returned by handlers that don't support the requested
+// format.
+var ErrInvalidFormat = errors.New("Invalid format")
+
+// InvalidFormat returns a handler always failing with ErrInvalidFormat.
+func InvalidFormat() Handler {
+	return func(_ string, _ io.Reader) error {
+		return ErrInvalidFormat
+	}
+}
+
+// ParseError is returned by handlers when the content of an entry can't be
+// read or parsed. It is also used for errors in the structure of a TAR file.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse calls 'read', usually the ReadFrom method of an index, a graph, an
+// index of binary references or a segment, and wraps the error it returns, if
+// any, in a ParseError.
+func Parse(read func(io.Reader) (int64, error), r io.Reader) (int64, error) {
+	n, err := read(r)
+	if err != nil {
+		return n, &ParseError{err}
+	}
+	return n, nil
+}
+
+// encoder writes a value to a writer in a structured format.
+type encoder func(w io.Writer, v interface{}) error
+
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// encodeYAML writes a value as a YAML document. The document starts with a
+// separator, so that the documents printed for several entries or TAR files
+// form a valid YAML stream.
+func encodeYAML(w io.Writer, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// PrintHexTo returns a handler printing a hex dump of the content of an entry.
+func PrintHexTo(w io.Writer) Handler {
+	return func(_ string, r io.Reader) (err error) {
+		d := hex.Dumper(w)
+		defer d.Close()
+		_, err = io.Copy(d, r)
+		return
+	}
+}
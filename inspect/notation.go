@@ -0,0 +1,40 @@
+package inspect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Notation controls how segment IDs and hexadecimal numbers are printed in
+// text format. If 'Dashed' is true, segment IDs are printed as canonical UUIDs,
+// with dashes separating groups of 8, 4, 4, 4 and 12 hexadecimal digits. If
+// 'Upper' is true, hexadecimal digits are printed in upper case.
+type Notation struct {
+	Dashed bool
+	Upper  bool
+}
+
+// SegmentID formats the most and least significant bits of a segment ID.
+func (n Notation) SegmentID(msb, lsb uint64) string {
+	id := SegmentID(msb, lsb)
+	if n.Dashed {
+		id = fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", msb>>32, msb>>16&0xffff, msb&0xffff, lsb>>48, lsb&0xffffffffffff)
+	}
+	if n.Upper {
+		return strings.ToUpper(id)
+	}
+	return id
+}
+
+// ID formats a well-formed segment ID, as returned by ParseSegmentID.
+func (n Notation) ID(id string) string {
+	return n.SegmentID(SegmentIDParts(id))
+}
+
+// Hex formats a number in hexadecimal.
+func (n Notation) Hex(v int) string {
+	if n.Upper {
+		return fmt.Sprintf("%X", v)
+	}
+	return fmt.Sprintf("%x", v)
+}
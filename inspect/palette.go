@@ -0,0 +1,58 @@
+package inspect
+
+import (
+	"fmt"
+
+	"github.com/francescomari/sdb/segment"
+)
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// Palette colors parts of the text output with ANSI escape sequences. The
+// text is returned unchanged if the palette is disabled.
+type Palette bool
+
+func (p Palette) paint(color, s string) string {
+	if !p {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// SegmentType returns the type of a segment, using the same colors as the
+// graph in dot format.
+func (p Palette) SegmentType(id string) string {
+	if IsBulkSegmentID(id) {
+		return p.paint(ansiRed, SegmentType(id))
+	}
+	return p.paint(ansiBlue, SegmentType(id))
+}
+
+// RecordType returns the name of a record type, colored by category: values,
+// structures of the content tree, and collections.
+func (p Palette) RecordType(t segment.RecordType) string {
+	switch t {
+	case segment.RecordTypeValue, segment.RecordTypeBlock, segment.RecordTypeBlobID:
+		return p.paint(ansiGreen, RecordType(t))
+	case segment.RecordTypeNode, segment.RecordTypeTemplate:
+		return p.paint(ansiYellow, RecordType(t))
+	case segment.RecordTypeList, segment.RecordTypeListBucket, segment.RecordTypeMapLeaf, segment.RecordTypeMapBranch:
+		return p.paint(ansiCyan, RecordType(t))
+	default:
+		return p.paint(ansiMagenta, RecordType(t))
+	}
+}
+
+// Generation returns a highlighted generation number.
+func (p Palette) Generation(g int) string {
+	return p.paint(ansiBold, fmt.Sprint(g))
+}
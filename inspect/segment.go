@@ -0,0 +1,274 @@
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/segment"
+)
+
+// SegmentView selects the records of a segment and the additional information
+// printed for each of them. A nil 'Keep' selects every record. If 'Sizes' is
+// true, the size of every record is printed. If 'Decode' is true, the content
+// of value and blob ID records is printed, truncated to 'MaxLength' bytes
+// unless 'MaxLength' is negative. If 'ResolveRefs' is true, the records
+// pointing to other segments are annotated with the IDs of the records they
+// point to. If 'Index' is not nil, the references are annotated with their
+// index entries. The types of the records are colored by 'Color', and the
+// references, the numbers and offsets of the records and the record IDs are
+// printed in 'Notation' in text format.
+type SegmentView struct {
+	Keep        RecordFilter
+	Sizes       bool
+	Decode      bool
+	MaxLength   int
+	ResolveRefs bool
+	Index       *index.Index
+	Color       Palette
+	Notation    Notation
+}
+
+func (v SegmentView) keeps(r segment.Record) bool {
+	return v.Keep == nil || v.Keep(r)
+}
+
+func (v SegmentView) decodes(r segment.Record) bool {
+	return v.Decode && (r.Type == segment.RecordTypeValue || r.Type == segment.RecordTypeBlobID)
+}
+
+// PrintSegment returns a handler printing a segment in the specified format.
+func PrintSegment(f Format, v SegmentView, w io.Writer) Handler {
+	switch f {
+	case FormatHex:
+		return PrintHexTo(w)
+	case FormatText:
+		return PrintSegmentTo(v, w)
+	case FormatJSON:
+		return printSegmentEncodedTo(v, encodeJSON, w)
+	case FormatYAML:
+		return printSegmentEncodedTo(v, encodeYAML, w)
+	default:
+		return InvalidFormat()
+	}
+}
+
+// PrintSegmentTo returns a handler printing a segment in text format. The
+// header and every reference and record of the segment are printed on their own
+// line. A value that can't be decoded, or references that can't be resolved
+// because the record is truncated, are printed as '?', and the remaining
+// records are printed anyway.
+func PrintSegmentTo(v SegmentView, w io.Writer) Handler {
+	return func(n string, r io.Reader) error {
+		var s segment.Segment
+		if _, err := Parse(s.ReadFrom, r); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "version %d\n", s.Version)
+		fmt.Fprintf(w, "generation %d\n", s.Generation)
+		fmt.Fprintf(w, "fullGeneration %d\n", s.FullGeneration)
+		fmt.Fprintf(w, "compacted %v\n", s.Compacted)
+		for i, r := range s.References {
+			printed := v.Notation.SegmentID(r.Msb, r.Lsb)
+			if v.Index == nil {
+				fmt.Fprintf(w, "reference %d %s\n", i+1, printed)
+				continue
+			}
+			if e, ok := v.Index.Lookup(r.Msb, r.Lsb); ok {
+				fmt.Fprintf(w, "reference %d %s %s %d %d\n", i+1, printed, v.Notation.Hex(e.Position), e.Size, e.Generation)
+			} else {
+				fmt.Fprintf(w, "reference %d %s (not in index)\n", i+1, printed)
+			}
+		}
+		sizes := s.RecordSizes()
+		for i, r := range s.Records {
+			if !v.keeps(r) {
+				continue
+			}
+			fmt.Fprintf(w, "record %s %s %s", v.Notation.Hex(r.Number), v.Color.RecordType(r.Type), v.Notation.Hex(r.Offset))
+			if v.Sizes {
+				if sizes[i] < 0 {
+					fmt.Fprintf(w, " ?")
+				} else {
+					fmt.Fprintf(w, " %d", sizes[i])
+				}
+			}
+			if v.decodes(r) {
+				if value, err := s.Value(r); err != nil {
+					fmt.Fprintf(w, " ?")
+				} else {
+					fmt.Fprintf(w, " %s", formatValue(EntrySegmentID(n), &s, value, v.MaxLength, v.Notation))
+				}
+			}
+			if v.ResolveRefs {
+				if refs, err := externalReferences(EntrySegmentID(n), &s, r, v.Notation); err != nil {
+					fmt.Fprintf(w, " ref ?")
+				} else {
+					for _, ref := range refs {
+						fmt.Fprintf(w, " ref %s", ref)
+					}
+				}
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	}
+}
+
+type jsonSegment struct {
+	Version        int                 `json:"version" yaml:"version"`
+	Generation     int                 `json:"generation" yaml:"generation"`
+	FullGeneration int                 `json:"fullGeneration" yaml:"fullGeneration"`
+	Compacted      bool                `json:"compacted" yaml:"compacted"`
+	References     []string            `json:"references" yaml:"references"`
+	Records        []jsonSegmentRecord `json:"records" yaml:"records"`
+}
+
+type jsonSegmentRecord struct {
+	Number     int        `json:"number" yaml:"number"`
+	Type       string     `json:"type" yaml:"type"`
+	Offset     int        `json:"offset" yaml:"offset"`
+	Size       *int       `json:"size,omitempty" yaml:"size,omitempty"`
+	Value      *jsonValue `json:"value,omitempty" yaml:"value,omitempty"`
+	References []string   `json:"references,omitempty" yaml:"references,omitempty"`
+	Error      string     `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type jsonValue struct {
+	Kind      string `json:"kind" yaml:"kind"`
+	Length    int64  `json:"length" yaml:"length"`
+	Data      string `json:"data,omitempty" yaml:"data,omitempty"`
+	Truncated bool   `json:"truncated,omitempty" yaml:"truncated,omitempty"`
+	Reference string `json:"reference,omitempty" yaml:"reference,omitempty"`
+}
+
+func printSegmentEncodedTo(v SegmentView, encode encoder, w io.Writer) Handler {
+	return func(n string, r io.Reader) error {
+		var s segment.Segment
+		if _, err := Parse(s.ReadFrom, r); err != nil {
+			return err
+		}
+		js := jsonSegment{
+			Version:        s.Version,
+			Generation:     s.Generation,
+			FullGeneration: s.FullGeneration,
+			Compacted:      s.Compacted,
+			References:     make([]string, 0, len(s.References)),
+			Records:        []jsonSegmentRecord{},
+		}
+		for _, r := range s.References {
+			js.References = append(js.References, SegmentID(r.Msb, r.Lsb))
+		}
+		sizes := s.RecordSizes()
+		for i, r := range s.Records {
+			if !v.keeps(r) {
+				continue
+			}
+			jr := jsonSegmentRecord{Number: r.Number, Type: RecordType(r.Type), Offset: r.Offset}
+			if v.Sizes && sizes[i] >= 0 {
+				jr.Size = &sizes[i]
+			}
+			if v.decodes(r) {
+				if value, err := s.Value(r); err != nil {
+					jr.Error = err.Error()
+				} else {
+					jr.Value = newJSONValue(EntrySegmentID(n), &s, value, v.MaxLength)
+				}
+			}
+			if v.ResolveRefs {
+				if refs, err := externalReferences(EntrySegmentID(n), &s, r, Notation{}); err != nil {
+					jr.Error = err.Error()
+				} else {
+					jr.References = refs
+				}
+			}
+			js.Records = append(js.Records, jr)
+		}
+		return encode(w, js)
+	}
+}
+
+func truncate(data []byte, maxLength int) ([]byte, bool) {
+	if maxLength >= 0 && len(data) > maxLength {
+		return data[:maxLength], true
+	}
+	return data, false
+}
+
+func formatValue(self string, s *segment.Segment, v segment.Value, maxLength int, nt Notation) string {
+	switch v.Kind {
+	case segment.ValueKindInline:
+		data, truncated := truncate(v.Data, maxLength)
+		if truncated {
+			return strconv.Quote(string(data)) + "..."
+		}
+		return strconv.Quote(string(data))
+	case segment.ValueKindLong:
+		return fmt.Sprintf("long:%d:%s", v.Length, recordID(self, s, v.Reference, nt))
+	case segment.ValueKindBlobID:
+		return "blob:" + strconv.Quote(string(v.Data))
+	case segment.ValueKindLongBlobID:
+		return "blob:" + recordID(self, s, v.Reference, nt)
+	default:
+		return "unknown"
+	}
+}
+
+func newJSONValue(self string, s *segment.Segment, v segment.Value, maxLength int) *jsonValue {
+	switch v.Kind {
+	case segment.ValueKindInline:
+		data, truncated := truncate(v.Data, maxLength)
+		return &jsonValue{Kind: "inline", Length: v.Length, Data: string(data), Truncated: truncated}
+	case segment.ValueKindLong:
+		return &jsonValue{Kind: "long", Length: v.Length, Reference: recordID(self, s, v.Reference, Notation{})}
+	case segment.ValueKindBlobID:
+		return &jsonValue{Kind: "blobId", Length: v.Length, Data: string(v.Data)}
+	case segment.ValueKindLongBlobID:
+		return &jsonValue{Kind: "longBlobId", Reference: recordID(self, s, v.Reference, Notation{})}
+	default:
+		return &jsonValue{Kind: "unknown"}
+	}
+}
+
+// recordID formats a record ID in 'nt', resolving its segment against the
+// references of the segment 'self'. If the ID of the segment is unknown, 'self'
+// is empty and only the number of the record is printed for the records in the
+// segment.
+func recordID(self string, s *segment.Segment, id segment.RecordID, nt Notation) string {
+	number := fmt.Sprintf("%08x", id.Number)
+	if nt.Upper {
+		number = fmt.Sprintf("%08X", id.Number)
+	}
+	if id.Segment == 0 && self == "" {
+		return number
+	}
+	if id.Segment == 0 {
+		if CheckSegmentID(self) == nil {
+			self = nt.ID(self)
+		}
+		return self + "." + number
+	}
+	if id.Segment > len(s.References) {
+		return "INVALID-REF." + number
+	}
+	r := s.References[id.Segment-1]
+	return nt.SegmentID(r.Msb, r.Lsb) + "." + number
+}
+
+// externalReferences returns the IDs of the records in other segments that a
+// record of the segment 'self' points to, resolved against the references of
+// the segment and formatted in 'nt'.
+func externalReferences(self string, s *segment.Segment, r segment.Record, nt Notation) ([]string, error) {
+	ids, err := s.RecordReferences(r)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, id := range ids {
+		if id.Segment != 0 {
+			refs = append(refs, recordID(self, s, id, nt))
+		}
+	}
+	return refs, nil
+}
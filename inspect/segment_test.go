@@ -0,0 +1,127 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/segment"
+)
+
+type testRecord struct {
+	number int
+	typ    segment.RecordType
+	data   []byte
+}
+
+// testSegmentData serializes a segment in the most recent format, referencing
+// the segments in 'references'. The content of the records is stored at the
+// end of the segment, in the same order as the records.
+func testSegmentData(references [][2]uint64, records ...testRecord) []byte {
+	total := 0
+	for _, r := range records {
+		total += len(r.data)
+	}
+	var (
+		header = 32 + 16*len(references) + 9*len(records)
+		data   = make([]byte, header+total)
+	)
+	copy(data, "0aK")
+	data[3] = 13
+	binary.BigEndian.PutUint32(data[10:], 1)
+	binary.BigEndian.PutUint32(data[14:], uint32(len(references)))
+	binary.BigEndian.PutUint32(data[18:], uint32(len(records)))
+	for i, r := range references {
+		binary.BigEndian.PutUint64(data[32+16*i:], r[0])
+		binary.BigEndian.PutUint64(data[32+16*i+8:], r[1])
+	}
+	offset := segment.MaxSize
+	for i, r := range records {
+		offset -= len(r.data)
+		p := 32 + 16*len(references) + 9*i
+		binary.BigEndian.PutUint32(data[p:], uint32(r.number))
+		data[p+4] = byte(r.typ)
+		binary.BigEndian.PutUint32(data[p+5:], uint32(offset))
+		copy(data[len(data)-(segment.MaxSize-offset):], r.data)
+	}
+	return data
+}
+
+func TestPrintSegmentWithTruncatedRecord(t *testing.T) {
+	data := testSegmentData(
+		[][2]uint64{{0x2222222222224222, 0xa222222222222222}},
+		testRecord{0, segment.RecordTypeNode, []byte{0, 1, 0}},
+		testRecord{1, segment.RecordTypeList, []byte{0, 0, 0, 1, 0, 1, 0, 0, 0, 4}},
+		testRecord{2, segment.RecordTypeValue, []byte("\x02hi")},
+	)
+	v := SegmentView{Keep: AnyRecord, Decode: true, MaxLength: -1, ResolveRefs: true}
+	var b bytes.Buffer
+	if err := PrintSegmentTo(v, &b)("", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	records := b.String()[strings.Index(b.String(), "record"):]
+	want := "" +
+		"record 0 node 3fffd ref ?\n" +
+		"record 1 list 3fff3 ref 2222222222224222a222222222222222.00000004\n" +
+		"record 2 value 3fff0 \"hi\"\n"
+	if records != want {
+		t.Fatalf("got\n%s\nwant\n%s", records, want)
+	}
+	b.Reset()
+	if err := printSegmentEncodedTo(v, encodeJSON, &b)("", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"error":"record 0: not enough data"`) {
+		t.Fatalf("missing error in %s", b.String())
+	}
+}
+
+func TestPrintSegmentRecordIDNotation(t *testing.T) {
+	data := testSegmentData(
+		[][2]uint64{{0x2222222222224222, 0xa222222222222222}},
+		testRecord{0xa, segment.RecordTypeList, []byte{0, 0, 0, 1, 0, 1, 0, 0, 0, 0xb}},
+	)
+	v := SegmentView{Keep: AnyRecord, MaxLength: -1, ResolveRefs: true, Notation: Notation{Dashed: true, Upper: true}}
+	var b bytes.Buffer
+	if err := PrintSegmentTo(v, &b)("", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	want := "record A list 3FFF6 ref 22222222-2222-4222-A222-222222222222.0000000B\n"
+	if !strings.HasSuffix(b.String(), want) {
+		t.Fatalf("got\n%s\nwant suffix\n%s", b.String(), want)
+	}
+}
+
+func TestPrintSegmentIndexedReferences(t *testing.T) {
+	data := testSegmentData([][2]uint64{
+		{0x2222222222224222, 0xa222222222222222},
+		{0x3333333333334333, 0xa333333333333333},
+	})
+	idx := &index.Index{Entries: []index.Entry{
+		{Msb: 0x2222222222224222, Lsb: 0xa222222222222222, Position: 0x200, Size: 100, Generation: 4},
+	}}
+	var b bytes.Buffer
+	if err := PrintSegmentTo(SegmentView{Keep: AnyRecord, Index: idx}, &b)("", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	want := "reference 1 2222222222224222a222222222222222 200 100 4\n" +
+		"reference 2 3333333333334333a333333333333333 (not in index)\n"
+	if !strings.HasSuffix(b.String(), want) {
+		t.Fatalf("got\n%s\nwant suffix\n%s", b.String(), want)
+	}
+}
+
+func TestPrintSegmentWithoutKeep(t *testing.T) {
+	data := testSegmentData(nil, testRecord{1, segment.RecordTypeValue, []byte{2, 'h', 'i'}})
+	for _, f := range []Format{FormatText, FormatJSON, FormatYAML} {
+		var b bytes.Buffer
+		if err := PrintSegment(f, SegmentView{}, &b)("", bytes.NewReader(data)); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if !strings.Contains(b.String(), "value") {
+			t.Fatalf("%s: record not printed in\n%s", f, b.String())
+		}
+	}
+}
@@ -2,22 +2,60 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"strconv"
 
+	"github.com/francescomari/sdb/inspect"
 	"github.com/spf13/cobra"
 )
 
 func main() {
 	if err := newRootCommand().Execute(); err != nil {
-		os.Exit(1)
+		exit(1)
 	}
 }
 
 func newRootCommand() *cobra.Command {
+	var (
+		noDecompress bool
+		strict       bool
+		output       string
+	)
 	cmd := &cobra.Command{
 		Use:   "sdb [command]",
 		Short: "SDB is collection of utilities for Apache Jackrabbit Oak's Segment Store",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			autoDecompress = !noDecompress
+			entryPolicy.strict = strict
+			if output == "" {
+				return
+			}
+			if err := redirectOutput(output); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to write the output: %v.\n", err)
+				exit(1)
+			}
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if err := commitOutput(); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to write the output: %v.\n", err)
+				exit(1)
+			}
+			if entryPolicy.skippedEntries() > 0 {
+				exit(exitParseError)
+			}
+		},
 	}
+	cmd.PersistentFlags().Bool("no-header", false, "Don't print a header before the output for every TAR file")
+	cmd.PersistentFlags().Bool("progress", false, "Periodically print the number of entries processed to standard error")
+	color := colorAuto
+	cmd.PersistentFlags().Var(&color, "color", "Color the text output (auto, always, never)")
+	cmd.PersistentFlags().Bool("dashed", false, "Print segment IDs as UUIDs with dashes in text format")
+	cmd.PersistentFlags().Bool("upper", false, "Print segment IDs and hexadecimal numbers in upper case in text format")
+	cmd.PersistentFlags().BoolVar(&noDecompress, "no-decompress", false, "Don't decompress gzip-compressed TAR files and entries")
+	cmd.PersistentFlags().StringVarP(&output, "output", "o", "", "Write the output to the specified file, replacing it only if the command succeeds")
+	cmd.PersistentFlags().BoolVar(&strict, "strict", false, "Stop at the first entry that can't be parsed instead of printing a warning")
 	cmd.AddCommand(newTarsCommand())
 	cmd.AddCommand(newEntriesCommand())
 	cmd.AddCommand(newSegmentsCommand())
@@ -25,11 +63,28 @@ func newRootCommand() *cobra.Command {
 	cmd.AddCommand(newIndexCommand())
 	cmd.AddCommand(newGraphCommand())
 	cmd.AddCommand(newBinariesCommand())
+	cmd.AddCommand(newStatsCommand())
+	cmd.AddCommand(newRecordsCommand())
+	cmd.AddCommand(newCheckCommand())
+	cmd.AddCommand(newDiffCommand())
+	cmd.AddCommand(newCrossCheckCommand())
+	cmd.AddCommand(newReachCommand())
+	cmd.AddCommand(newDumpCommand())
+	cmd.AddCommand(newListCommand())
+	cmd.AddCommand(newMissingCommand())
+	cmd.AddCommand(newLookupCommand())
+	cmd.AddCommand(newSizesCommand())
+	cmd.AddCommand(newHistogramCommand())
 	return cmd
 }
 
 func newTarsCommand() *cobra.Command {
-	var all bool
+	var (
+		all     bool
+		summary bool
+		human   bool
+		jobs    = runtime.NumCPU()
+	)
 	cmd := &cobra.Command{
 		Use:   "tars [dir]",
 		Short: "Prints the TAR files at the provided path.",
@@ -37,186 +92,893 @@ func newTarsCommand() *cobra.Command {
 			directory, err := os.Getwd()
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Unable to determine the working directory: %v.\n", err)
-				os.Exit(1)
+				exit(1)
 			}
 			if len(args) > 1 {
 				fmt.Fprintf(os.Stderr, "Too many arguments.\n")
-				os.Exit(1)
+				exit(1)
 			}
 			if len(args) == 1 {
 				directory = args[0]
 			}
+			if summary {
+				ok, err := printTarSummaries(directory, all, jobs, human, os.Stdout)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to summarize TAR files: %v.\n", err)
+					exit(exitCode(err))
+				}
+				if !ok {
+					exit(1)
+				}
+				return
+			}
 			if err := forEachTarFile(directory, all, doPrintTo(os.Stdout)); err != nil {
 				fmt.Fprintf(os.Stderr, "Unable to print TAR files: %v.\n", err)
-				os.Exit(1)
+				exit(exitCode(err))
 			}
 		},
 	}
 	cmd.Flags().BoolVar(&all, "all", false, "List both active and non-active TAR files")
+	cmd.Flags().BoolVar(&summary, "summary", false, "Print a summary of the index, the graph and the index of binary references of every TAR file")
+	cmd.Flags().BoolVar(&human, "human", false, "Print the sizes in the summary in a human-readable format")
+	cmd.Flags().IntVar(&jobs, "jobs", jobs, "Number of TAR files summarized concurrently")
 	return cmd
 }
 
 func newEntriesCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "entries file",
-		Short: "Prints the entries from the specified TAR file.",
+	f := inspect.FormatText
+	var long bool
+	cmd := &cobra.Command{
+		Use:   "entries file...",
+		Short: "Prints the entries from the specified TAR files.",
 		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) > 1 {
-				fmt.Fprintf(os.Stderr, "Too many arguments.\n")
-				os.Exit(1)
-			}
 			if len(args) < 1 {
 				fmt.Fprintf(os.Stderr, "Too few arguments.\n")
-				os.Exit(1)
+				exit(1)
 			}
-			if err := forEachEntry(args[0], doPrintNameTo(os.Stdout)); err != nil {
-				fmt.Fprintf(os.Stderr, "Unable to print TAR entries: %v.\n", err)
-				os.Exit(1)
+			if f != inspect.FormatText && f != inspect.FormatJSON {
+				fmt.Fprintf(os.Stderr, "Unable to print TAR entries: %v.\n", inspect.ErrInvalidFormat)
+				exit(exitCode(inspect.ErrInvalidFormat))
+			}
+			code := forEachPath(cmd, args, "Unable to print TAR entries", func(p string) error {
+				if !long && f == inspect.FormatText {
+					return forEachMatchingEntry(p, withProgress(cmd, any), doPrintNameTo(os.Stdout))
+				}
+				h, print := doListEntries(f, os.Stdout)
+				if err := forEachMatchingEntryHeader(p, withProgress(cmd, any), h); err != nil {
+					return err
+				}
+				return print()
+			})
+			if code != exitSuccess {
+				exit(code)
 			}
 		},
 	}
+	cmd.Flags().VarP(&f, "format", "f", "Output format (text, json)")
+	cmd.Flags().BoolVarP(&long, "long", "l", false, "Print the kind and the size of every entry, followed by a summary")
+	return cmd
 }
 
 func newSegmentsCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "segments file",
-		Short: "Prints the identifiers of the segments from the specified TAR file.",
+	var generation int
+	g := anyGeneration()
+	cmd := &cobra.Command{
+		Use:   "segments file...",
+		Short: "Prints the identifiers of the segments from the specified TAR files.",
 		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) > 1 {
-				fmt.Fprintln(os.Stderr, "Too many arguments.")
-				os.Exit(1)
-			}
 			if len(args) < 1 {
 				fmt.Fprintln(os.Stderr, "Too few arguments.")
-				os.Exit(1)
+				exit(1)
 			}
-			if err := forEachMatchingEntry(args[0], isAnySegment, doPrintSegmentNameTo(os.Stdout)); err != nil {
-				fmt.Fprintf(os.Stderr, "Unable to print segment IDs: %v.\n", err)
-				os.Exit(1)
+			g, err := resolveGenerations(cmd, generation, g)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid generation filter: %v.\n", err)
+				exit(1)
+			}
+			h := doPrintSegmentNameTo(withNotation(cmd), os.Stdout)
+			code := forEachPath(cmd, args, "Unable to print segment IDs", func(p string) error {
+				m := isAnySegment
+				if !g.isAny() {
+					idx, err := readIndex(p)
+					if err != nil {
+						return err
+					}
+					m = isSegmentOfGeneration(g, idx)
+				}
+				return forEachMatchingEntry(p, withProgress(cmd, m), h)
+			})
+			if code != exitSuccess {
+				exit(code)
 			}
 		},
 	}
+	addGenerationFlags(cmd, &generation, &g)
+	return cmd
 }
 
 func newSegmentCommand() *cobra.Command {
-	f := formatText
+	f := inspect.FormatText
+	var (
+		recordTypes  []string
+		countRecords bool
+		sizes        bool
+		decode       bool
+		maxLength    int
+		resolveRefs  bool
+		record       string
+		header       bool
+		raw          bool
+		verify       bool
+		minVersion   int
+		maxVersion   = -1
+		indexPath    string
+	)
 	cmd := &cobra.Command{
-		Use:   "segment file id",
-		Short: "Prints the identifiers of the segments from the specified TAR file.",
+		Use:   "segment (file... id | -)",
+		Short: "Prints the content of a segment from the specified TAR files, or from the standard input.",
 		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) < 2 {
+			stdin := len(args) == 1 && args[0] == "-"
+			if len(args) < 2 && !stdin {
 				fmt.Fprintf(os.Stderr, "Too few arguments.\n")
-				os.Exit(1)
+				exit(1)
 			}
-			if len(args) > 2 {
-				fmt.Fprintf(os.Stderr, "Too many arguments.\n")
-				os.Exit(1)
+			var id string
+			if !stdin {
+				var err error
+				if id, err = inspect.ParseSegmentID(args[len(args)-1]); err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to print segment: %v.\n", err)
+					exit(1)
+				}
 			}
-			if err := onMatchingEntry(args[0], isSegment(args[1]), doPrintSegment(f, os.Stdout)); err != nil {
+			keep, err := inspect.RecordTypesFilter(recordTypes)
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "Unable to print segment: %v.\n", err)
-				os.Exit(1)
+				exit(1)
+			}
+			v := inspect.SegmentView{
+				Keep:        keep,
+				Sizes:       sizes,
+				Decode:      decode,
+				MaxLength:   maxLength,
+				ResolveRefs: resolveRefs,
+				Color:       withColor(cmd, os.Stdout),
+				Notation:    withNotation(cmd),
+			}
+			if indexPath != "" {
+				if v.Index, err = readIndex(indexPath); err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to read the index: %v.\n", err)
+					exit(exitCode(err))
+				}
+			}
+			h := inspect.PrintSegment(f, v, os.Stdout)
+			if countRecords {
+				h = doPrintRecordCounts(f, keep, os.Stdout)
+			}
+			if record != "" {
+				number, err := parseRecordNumber(record)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid record number: %v.\n", err)
+					exit(1)
+				}
+				h = doPrintRecordTo(number, raw, os.Stdout)
+			}
+			if header {
+				h = doPrintSegmentHeader(f, os.Stdout)
+			}
+			if verify {
+				h = doVerifySegment(withNotation(cmd), os.Stdout)
+			}
+			if minVersion > 0 || maxVersion >= 0 {
+				h = onSegmentVersion(minVersion, maxVersion, h)
+			}
+			msg := "Unable to print segment"
+			if verify {
+				msg = "Unable to verify segment"
+			}
+			if stdin {
+				if err := h("", os.Stdin); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v.\n", msg, err)
+					exit(exitCode(err))
+				}
+				return
+			}
+			code := forEachPath(cmd, args[:len(args)-1], msg, func(p string) error {
+				return onMatchingEntry(p, isSegment(id), h)
+			})
+			if code != exitSuccess {
+				exit(code)
 			}
 		},
 	}
-	cmd.Flags().Var(&f, "format", "Output format (text, hex)")
+	cmd.Flags().VarP(&f, "format", "f", "Output format (text, hex, json, yaml)")
+	cmd.Flags().StringSliceVar(&recordTypes, "record-type", nil, "Only print records of the specified types")
+	cmd.Flags().BoolVar(&countRecords, "count-records", false, "Print the number of records of every type instead of the records")
+	cmd.Flags().BoolVar(&sizes, "sizes", false, "Print the size of every record")
+	cmd.Flags().BoolVar(&decode, "decode", false, "Print the content of value and binary records")
+	cmd.Flags().BoolVar(&resolveRefs, "resolve-refs", false, "Print the records in other segments that node, list and map records point to")
+	cmd.Flags().StringVar(&indexPath, "index", "", "Annotate the references with the index of the TAR files at the specified path")
+	cmd.Flags().StringVar(&record, "record", "", "Print a hex dump of the record with the specified hexadecimal number")
+	cmd.Flags().BoolVar(&raw, "raw", false, "Print the bytes of the record selected by --record instead of a hex dump")
+	cmd.Flags().BoolVar(&header, "header", false, "Print the fields of the header of the segment on one line, or a hex dump of the header with --format hex")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Check the offsets and the numbers of the records and the references instead of printing the segment")
+	cmd.Flags().IntVar(&maxLength, "max-length", 64, "Maximum number of bytes printed for every value decoded by --decode (negative for no limit)")
+	cmd.Flags().IntVar(&minVersion, "min-version", minVersion, "Fail if the version of the segment is older than the specified one")
+	cmd.Flags().IntVar(&maxVersion, "max-version", maxVersion, "Fail if the version of the segment is newer than the specified one (negative for no limit)")
+	cmd.MarkFlagsMutuallyExclusive("count-records", "record", "header", "verify")
 	return cmd
 }
 
 func newIndexCommand() *cobra.Command {
-	f := formatText
+	f := inspect.FormatText
+	var (
+		generation   int
+		stats        bool
+		checkOverlap bool
+	)
+	g := anyGeneration()
+	var (
+		t       segmentTypeFilter
+		sortBy  inspect.IndexSortKey
+		reverse bool
+		ids     []string
+		page    = inspect.AllEntries()
+		human   bool
+		idsOnly bool
+	)
 	cmd := &cobra.Command{
-		Use:   "index",
-		Short: "Prints the index from the specified TAR file",
+		Use:   "index file...",
+		Short: "Prints the index from the specified TAR files",
 		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) > 1 {
+			if len(args) < 1 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			g, err := resolveGenerations(cmd, generation, g)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid generation filter: %v.\n", err)
+				exit(1)
+			}
+			keepIDs, err := segmentIDPrefixesFilter(ids)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid segment ID filter: %v.\n", err)
+				exit(1)
+			}
+			v := inspect.IndexView{
+				Keep:     inspect.AllOf(g.indexFilter(), t.idFilter().And(keepIDs).IndexFilter()),
+				SortBy:   sortBy,
+				Reverse:  reverse,
+				Page:     page,
+				Human:    human,
+				IDsOnly:  idsOnly,
+				Color:    withColor(cmd, os.Stdout),
+				Notation: withNotation(cmd),
+			}
+			h := inspect.PrintIndex(f, v, os.Stdout)
+			if stats {
+				h = doPrintIndexStats(f, v, os.Stdout)
+			}
+			msg := "Unable to print the index"
+			if checkOverlap {
+				h = doCheckIndexOverlap(withNotation(cmd), os.Stdout)
+				msg = "Unable to check the index"
+			}
+			code := forEachPath(cmd, args, msg, func(p string) error {
+				return onMatchingEntry(p, isIndex, h)
+			})
+			if code != exitSuccess {
+				exit(code)
+			}
+		},
+	}
+	cmd.Flags().VarP(&f, "format", "f", "Output format (text, hex, json, yaml, csv)")
+	cmd.Flags().BoolVar(&stats, "stats", false, "Print aggregate statistics instead of the entries")
+	cmd.Flags().BoolVar(&checkOverlap, "check-overlap", false, "Print the entries whose byte ranges overlap and fail if there is any")
+	cmd.Flags().Var(&sortBy, "sort", "Sort the entries by a field (id, position, size, generation)")
+	cmd.Flags().BoolVar(&reverse, "reverse", false, "Print the entries in reverse order")
+	cmd.Flags().BoolVar(&human, "human", false, "Print sizes in a human-readable format")
+	cmd.Flags().BoolVar(&idsOnly, "ids-only", false, "Print only the segment IDs, one per line")
+	cmd.Flags().StringArrayVar(&ids, "id", nil, "Only include segments whose ID starts with the specified prefix")
+	cmd.Flags().Var(&t, "type", "Only include segments of the specified type (bulk, data)")
+	addGenerationFlags(cmd, &generation, &g)
+	addPagingFlags(cmd, &page)
+	return cmd
+}
+
+func newGraphCommand() *cobra.Command {
+	f := inspect.FormatText
+	var (
+		t           segmentTypeFilter
+		showOrphans bool
+		referrersOf string
+		checkCycles bool
+		dangling    bool
+		reversed    bool
+		root        string
+		maxDepth    int
+		showDepth   bool
+		ids         []string
+		page        = inspect.AllEntries()
+	)
+	cmd := &cobra.Command{
+		Use:   "graph file...",
+		Short: "Prints the graph from the specified TAR files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			keepIDs, err := segmentIDPrefixesFilter(ids)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid segment ID filter: %v.\n", err)
+				exit(1)
+			}
+			var (
+				keep = t.idFilter().And(keepIDs)
+				nt   = withNotation(cmd)
+			)
+			h := inspect.PrintGraph(f, keep, page, nt, os.Stdout)
+			if reversed {
+				h = doPrintReverseGraph(f, keep, nt, os.Stdout)
+			}
+			if showOrphans {
+				h = doPrintOrphans(f, nt, os.Stdout)
+			}
+			if checkCycles {
+				h = doPrintCycles(f, nt, os.Stdout)
+			}
+			if dangling {
+				h = doCheckDangling(f, nt, os.Stdout)
+			}
+			if root != "" {
+				id, err := inspect.ParseSegmentID(root)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to print the reachable segments: %v.\n", err)
+					exit(exitCode(err))
+				}
+				h = doPrintReachable(f, id, maxDepth, showDepth, nt, os.Stdout)
+			}
+			if referrersOf != "" {
+				id, err := inspect.ParseSegmentID(referrersOf)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to print the referrers: %v.\n", err)
+					exit(exitCode(err))
+				}
+				h = doPrintReferrers(f, id, nt, os.Stdout)
+			}
+			code := forEachPath(cmd, args, "Unable to print the graph", func(p string) error {
+				return onMatchingEntry(p, isGraph, h)
+			})
+			if code != exitSuccess {
+				exit(code)
+			}
+		},
+	}
+	cmd.Flags().VarP(&f, "format", "f", "Output format (text, hex, json, yaml, dot)")
+	cmd.Flags().StringArrayVar(&ids, "id", nil, "Only include segments whose ID starts with the specified prefix")
+	cmd.Flags().Var(&t, "type", "Only include segments of the specified type (bulk, data)")
+	cmd.Flags().BoolVar(&reversed, "reverse", false, "Print the segments referencing every segment")
+	cmd.Flags().BoolVar(&showOrphans, "orphans", false, "Print the segments not referenced by any other segment")
+	cmd.Flags().StringVar(&referrersOf, "referrers", "", "Print the segments referencing the specified segment")
+	cmd.Flags().BoolVar(&checkCycles, "check-cycles", false, "Print the cycles in the graph and fail if there is any")
+	cmd.Flags().BoolVar(&dangling, "check-dangling", false, "Print the references to segments without an entry in the graph")
+	cmd.Flags().StringVar(&root, "reachable", "", "Print the segments transitively referenced by the specified segment")
+	cmd.Flags().BoolVar(&showDepth, "show-depth", false, "Print the depth at which every segment is first reached by --reachable")
+	cmd.Flags().IntVar(&maxDepth, "depth", -1, "Maximum number of references followed by --reachable (negative for no limit)")
+	addPagingFlags(cmd, &page)
+	cmd.MarkFlagsMutuallyExclusive("reverse", "orphans", "check-cycles", "check-dangling", "reachable", "referrers")
+	return cmd
+}
+
+func newBinariesCommand() *cobra.Command {
+	f := inspect.FormatText
+	var parse, flat, count, summary, byReference bool
+	var grep string
+	page := inspect.AllEntries()
+	cmd := &cobra.Command{
+		Use:   "binaries file...",
+		Short: "Prints the index of binary references from the specified TAR files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			v := inspect.BinariesView{Page: page, Parse: parse, Flat: flat || count, Count: count, Grep: grep, Color: withColor(cmd, os.Stdout), Notation: withNotation(cmd)}
+			h := inspect.PrintBinaries(f, v, os.Stdout)
+			if byReference {
+				h = inspect.PrintBinariesByReference(f, v, os.Stdout)
+			}
+			if summary {
+				h = inspect.PrintBinariesSummary(f, os.Stdout)
+			}
+			code := forEachPath(cmd, args, "Unable to print the index of binary references", func(p string) error {
+				return onMatchingEntry(p, isBinary, h)
+			})
+			if code != exitSuccess {
+				exit(code)
+			}
+		},
+	}
+	cmd.Flags().VarP(&f, "format", "f", "Output format (text, hex, json, yaml)")
+	cmd.Flags().BoolVar(&parse, "parse", false, "Print the blob ID and the length of every reference in aligned columns")
+	cmd.Flags().BoolVar(&flat, "flat", false, "Print every distinct reference once, sorted")
+	cmd.Flags().BoolVar(&count, "count", false, "Print every distinct reference once, preceded by the number of segments referencing it")
+	cmd.Flags().BoolVar(&summary, "summary", false, "Print the number of segments and references of every generation instead of the references")
+	cmd.Flags().BoolVar(&byReference, "by-reference", false, "Print the segments referencing every distinct reference, most referenced first")
+	cmd.Flags().StringVar(&grep, "grep", "", "Only print the references containing the specified string")
+	addPagingFlags(cmd, &page)
+	return cmd
+}
+
+func newStatsCommand() *cobra.Command {
+	var (
+		f     = inspect.FormatText
+		human bool
+	)
+	cmd := &cobra.Command{
+		Use:   "stats file...",
+		Short: "Prints statistics about the segments in the specified TAR files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			code := forEachPath(cmd, args, "Unable to print statistics", func(p string) error {
+				s := newTarStats()
+				if err := forEachMatchingEntryHeader(p, withProgress(cmd, isAnySegment), doCollectStats(s)); err != nil {
+					return err
+				}
+				return printTarStats(f, s, human, os.Stdout)
+			})
+			if code != exitSuccess {
+				exit(code)
+			}
+		},
+	}
+	cmd.Flags().VarP(&f, "format", "f", "Output format (text, json)")
+	cmd.Flags().BoolVar(&human, "human", false, "Print sizes in a human-readable format")
+	return cmd
+}
+
+func newRecordsCommand() *cobra.Command {
+	f := inspect.FormatText
+	cmd := &cobra.Command{
+		Use:   "records file...",
+		Short: "Prints the number of records of every type in the data segments of the specified TAR files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			code := forEachPath(cmd, args, "Unable to count the records", func(p string) error {
+				c := newTarRecordCounts()
+				if err := forEachMatchingEntry(p, withProgress(cmd, isAnySegment), doCollectRecordCounts(c)); err != nil {
+					return err
+				}
+				return printTarRecordCounts(f, c, os.Stdout)
+			})
+			if code != exitSuccess {
+				exit(code)
+			}
+		},
+	}
+	cmd.Flags().VarP(&f, "format", "f", "Output format (text, json)")
+	return cmd
+}
+
+func newCheckCommand() *cobra.Command {
+	var fast bool
+	cmd := &cobra.Command{
+		Use:   "check file...",
+		Short: "Checks the integrity of the specified TAR files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			code := forEachPath(cmd, args, "Unable to check the TAR file", func(p string) error {
+				n, err := checkTarFile(p, fast, withNotation(cmd), os.Stdout)
+				if err != nil {
+					return err
+				}
+				if n > 0 {
+					return verificationFailed("found %d problems", n)
+				}
+				return nil
+			})
+			if code != exitSuccess {
+				exit(code)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&fast, "fast", false, "Don't parse the content of the segments")
+	return cmd
+}
+
+func newCrossCheckCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "crosscheck file...",
+		Short: "Checks that the index and the graph of the specified TAR files contain the same segments",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			code := forEachPath(cmd, args, "Unable to compare the index and the graph", func(p string) error {
+				h, verify := doVerifyIndexGraph(withNotation(cmd), os.Stdout)
+				if err := forEachMatchingEntry(p, withProgress(cmd, isIndexOrGraph), h); err != nil {
+					return err
+				}
+				return verify()
+			})
+			if code != exitSuccess {
+				exit(code)
+			}
+		},
+	}
+}
+
+func newReachCommand() *cobra.Command {
+	var invert bool
+	cmd := &cobra.Command{
+		Use:   "reach path id...",
+		Short: "Prints the segments reachable from the specified segments in a TAR file or in a directory of TAR files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			var roots []string
+			for _, arg := range args[1:] {
+				id, err := inspect.ParseSegmentID(arg)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid root: %v.\n", err)
+					exit(1)
+				}
+				roots = append(roots, id)
+			}
+			if err := printReachable(args[0], roots, invert, withNotation(cmd), os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to print the reachable segments: %v.\n", err)
+				exit(exitCode(err))
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&invert, "invert", false, "Print the unreachable segments instead")
+	return cmd
+}
+
+func newDiffCommand() *cobra.Command {
+	f := inspect.FormatText
+	cmd := &cobra.Command{
+		Use:   "diff file1 file2",
+		Short: "Prints the differences between the segments of two TAR files",
+		Long:  "Prints the differences between the segments of two TAR files. Exits with status 5 if there are differences.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 2 {
 				fmt.Fprintln(os.Stderr, "Too many arguments.")
-				os.Exit(1)
+				exit(1)
+			}
+			if len(args) < 2 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
 			}
+			differ, err := diffTarFiles(f, args[0], args[1], withNotation(cmd), os.Stdout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to compare the TAR files: %v.\n", err)
+				exit(exitCode(err))
+			}
+			if differ {
+				// Differences are the expected output of the command, and
+				// don't make it fail.
+				if err := commitOutput(); err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to write the output: %v.\n", err)
+					exit(1)
+				}
+				exit(exitDifferences)
+			}
+		},
+	}
+	cmd.Flags().VarP(&f, "format", "f", "Output format (text, json)")
+	return cmd
+}
+
+func newDumpCommand() *cobra.Command {
+	jobs := 1
+	cmd := &cobra.Command{
+		Use:   "dump file...",
+		Short: "Prints every entry of the specified TAR files",
+		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) < 1 {
 				fmt.Fprintln(os.Stderr, "Too few arguments.")
-				os.Exit(1)
+				exit(1)
+			}
+			var (
+				nt    = withNotation(cmd)
+				color = withColor(cmd, os.Stdout)
+			)
+			dump := func(w io.Writer) handler {
+				return doDumpTo(nt, color, w)
 			}
-			if err := onMatchingEntry(args[0], isIndex, doPrintIndex(f, os.Stdout)); err != nil {
-				fmt.Fprintf(os.Stderr, "Unable to print the index: %v.\n", err)
-				os.Exit(1)
+			code := forEachPath(cmd, args, "Unable to dump the TAR file", func(p string) error {
+				return forEachMatchingEntryConcurrently(p, withProgress(cmd, any), jobs, dump, os.Stdout)
+			})
+			if code != exitSuccess {
+				exit(code)
 			}
 		},
 	}
-	cmd.Flags().Var(&f, "format", "Output format (text, hex)")
+	cmd.Flags().IntVar(&jobs, "jobs", jobs, "Number of entries processed concurrently")
 	return cmd
 }
 
-func newGraphCommand() *cobra.Command {
-	f := formatText
+func newListCommand() *cobra.Command {
+	var bulk, data, count bool
+	cmd := &cobra.Command{
+		Use:   "list file...",
+		Short: "Prints the type and the ID of the segments in the index of the specified TAR files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			var t segmentTypeFilter
+			if bulk && !data {
+				t = "bulk"
+			}
+			if data && !bulk {
+				t = "data"
+			}
+			code := forEachPath(cmd, args, "Unable to list the segments", func(p string) error {
+				return onMatchingEntry(p, isIndex, doListSegments(t.idFilter(), count, withNotation(cmd), os.Stdout))
+			})
+			if code != exitSuccess {
+				exit(code)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&bulk, "bulk", false, "Only list bulk segments")
+	cmd.Flags().BoolVar(&data, "data", false, "Only list data segments")
+	cmd.Flags().BoolVar(&count, "count", false, "Print the number of segments instead of the list")
+	return cmd
+}
+
+func newMissingCommand() *cobra.Command {
+	var deep bool
 	cmd := &cobra.Command{
-		Use:   "graph",
-		Short: "Prints the graph from the specified TAR file",
+		Use:   "missing path",
+		Short: "Prints the referenced segments missing from the index of a TAR file or of a directory of TAR files",
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 1 {
 				fmt.Fprintln(os.Stderr, "Too many arguments.")
-				os.Exit(1)
+				exit(1)
 			}
 			if len(args) < 1 {
 				fmt.Fprintln(os.Stderr, "Too few arguments.")
-				os.Exit(1)
+				exit(1)
 			}
-			if err := onMatchingEntry(args[0], isGraph, doPrintGraph(f, os.Stdout)); err != nil {
-				fmt.Fprintf(os.Stderr, "Unable to print the graph: %v.\n", err)
-				os.Exit(1)
+			n, err := printMissing(args[0], deep, withNotation(cmd), os.Stdout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to print the missing segments: %v.\n", err)
+				exit(exitCode(err))
+			}
+			if n > 0 {
+				fmt.Fprintf(os.Stderr, "Found %d missing references.\n", n)
+				exit(exitVerificationError)
 			}
 		},
 	}
-	cmd.Flags().Var(&f, "format", "Output format (text, hex)")
+	cmd.Flags().BoolVar(&deep, "deep", false, "Also read the references stored in the data segments")
 	return cmd
 }
 
-func newBinariesCommand() *cobra.Command {
-	f := formatText
+func newLookupCommand() *cobra.Command {
+	f := inspect.FormatText
 	cmd := &cobra.Command{
-		Use:   "binaries",
-		Short: "Prints the index of binary references from the specified TAR file",
+		Use:   "lookup file id",
+		Short: "Prints the entry of a segment in the index of the specified TAR file",
 		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) > 1 {
+			if len(args) > 2 {
 				fmt.Fprintln(os.Stderr, "Too many arguments.")
-				os.Exit(1)
+				exit(1)
+			}
+			if len(args) < 2 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
 			}
+			id, err := inspect.ParseSegmentID(args[1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to look up the segment: %v.\n", err)
+				exit(1)
+			}
+			if err := onMatchingEntry(args[0], isIndex, inspect.Lookup(f, id, withNotation(cmd), os.Stdout)); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to look up the segment: %v.\n", err)
+				exit(exitCode(err))
+			}
+		},
+	}
+	cmd.Flags().VarP(&f, "format", "f", "Output format (text, json)")
+	return cmd
+}
+
+func newSizesCommand() *cobra.Command {
+	var human bool
+	cmd := &cobra.Command{
+		Use:   "sizes file...",
+		Short: "Prints the total size of the entries of the specified TAR files, grouped by kind",
+		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) < 1 {
 				fmt.Fprintln(os.Stderr, "Too few arguments.")
-				os.Exit(1)
+				exit(1)
+			}
+			var (
+				total  tarSizes
+				files  int
+				status exitStatus
+			)
+			for _, arg := range args {
+				paths, err := tarFilesIn(arg, true)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to compute the sizes: %v.\n", err)
+					status.fail(err)
+					continue
+				}
+				for _, p := range paths {
+					var s tarSizes
+					if err := forEachMatchingEntryHeader(p, withProgress(cmd, any), doCollectSizes(&s)); err != nil {
+						fmt.Fprintf(os.Stderr, "Unable to compute the sizes: %s: %v.\n", p, err)
+						status.fail(err)
+						continue
+					}
+					printTarSizes(p, &s, human, os.Stdout)
+					total.add(&s)
+					files++
+				}
 			}
-			if err := onMatchingEntry(args[0], isBinary, doPrintBinaries(f, os.Stdout)); err != nil {
-				fmt.Fprintf(os.Stderr, "Unable to print the index of binary references: %v.\n", err)
-				os.Exit(1)
+			if files > 1 {
+				printTarSizes("total", &total, human, os.Stdout)
+			}
+			if status != exitSuccess {
+				exit(int(status))
 			}
 		},
 	}
-	cmd.Flags().Var(&f, "format", "Output format (text, hex)")
+	cmd.Flags().BoolVar(&human, "human", false, "Print sizes in a human-readable format")
 	return cmd
 }
 
-type format string
+func newHistogramCommand() *cobra.Command {
+	var (
+		buckets []string
+		byType  bool
+	)
+	cmd := &cobra.Command{
+		Use:   "histogram file...",
+		Short: "Prints a histogram of the sizes of the segments in the indexes of the specified TAR files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fmt.Fprintln(os.Stderr, "Too few arguments.")
+				exit(1)
+			}
+			edges := defaultHistogramEdges
+			if len(buckets) > 0 {
+				var err error
+				if edges, err = parseHistogramEdges(buckets); err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid buckets: %v.\n", err)
+					exit(1)
+				}
+			}
+			var (
+				data   = newHistogram(edges)
+				bulk   = data
+				status exitStatus
+			)
+			if byType {
+				bulk = newHistogram(edges)
+			}
+			for _, arg := range args {
+				paths, err := tarFilesIn(arg, true)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to compute the histogram: %v.\n", err)
+					status.fail(err)
+					continue
+				}
+				for _, p := range paths {
+					if err := onMatchingEntry(p, isIndex, doCollectHistograms(data, bulk)); err != nil {
+						fmt.Fprintf(os.Stderr, "Unable to compute the histogram: %s: %v.\n", p, err)
+						status.fail(err)
+					}
+				}
+			}
+			printHistograms(data, bulk, terminalWidth(), os.Stdout)
+			if status != exitSuccess {
+				exit(int(status))
+			}
+		},
+	}
+	cmd.Flags().StringSliceVar(&buckets, "buckets", nil, "Upper edges of the buckets, in bytes or with a K or M suffix (default 1K,2K,...,256K)")
+	cmd.Flags().BoolVar(&byType, "by-type", false, "Print separate histograms for data and bulk segments")
+	return cmd
+}
 
-const (
-	formatText format = "text"
-	formatHex  format = "hex"
-)
+func addGenerationFlags(cmd *cobra.Command, generation *int, g *generations) {
+	cmd.Flags().IntVar(generation, "generation", 0, "Only include segments of the specified generation")
+	cmd.Flags().IntVar(&g.min, "min-generation", g.min, "Only include segments of this generation or newer")
+	cmd.Flags().IntVar(&g.max, "max-generation", g.max, "Only include segments of this generation or older (negative for no limit)")
+}
+
+func resolveGenerations(cmd *cobra.Command, generation int, g generations) (generations, error) {
+	if cmd.Flags().Changed("generation") {
+		if generation < 0 {
+			return g, fmt.Errorf("negative generation %d", generation)
+		}
+		return exactGeneration(generation), nil
+	}
+	if g.min < 0 {
+		return g, fmt.Errorf("negative minimum generation %d", g.min)
+	}
+	if g.max >= 0 && g.max < g.min {
+		return g, fmt.Errorf("maximum generation %d lower than minimum generation %d", g.max, g.min)
+	}
+	return g, nil
+}
+
+// limitValue is the value of the --limit flag. Negative limits are rejected,
+// because they are used by the pager to accept every entry, which is already
+// the default.
+type limitValue struct {
+	p *inspect.Pager
+}
+
+func (l limitValue) String() string {
+	if l.p.Limit < 0 {
+		return "none"
+	}
+	return strconv.Itoa(l.p.Limit)
+}
+
+func (l limitValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("Invalid limit '%s'", s)
+	}
+	if n < 0 {
+		return fmt.Errorf("Negative limit '%s'", s)
+	}
+	l.p.Limit = n
+	return nil
+}
 
-func (f *format) String() string {
-	return string(*f)
+func (l limitValue) Type() string {
+	return "int"
 }
 
-func (f *format) Set(s string) error {
-	switch format(s) {
-	case formatHex:
-		*f = formatHex
-	case formatText:
-		*f = formatText
-	default:
-		return fmt.Errorf("Invalid format '%s'", s)
+// skipValue is the value of the --skip flag. Negative values are rejected,
+// because they would move the end of the range before the requested limit.
+type skipValue struct {
+	p *inspect.Pager
+}
+
+func (s skipValue) String() string {
+	return strconv.Itoa(s.p.Skip)
+}
+
+func (s skipValue) Set(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("Invalid skip '%s'", v)
 	}
+	if n < 0 {
+		return fmt.Errorf("Negative skip '%s'", v)
+	}
+	s.p.Skip = n
 	return nil
 }
 
-func (f *format) Type() string {
-	return "format"
+func (s skipValue) Type() string {
+	return "int"
+}
+
+func addPagingFlags(cmd *cobra.Command, p *inspect.Pager) {
+	cmd.Flags().Var(skipValue{p}, "skip", "Skip the specified number of entries")
+	cmd.Flags().Var(limitValue{p}, "limit", "Print at most the specified number of entries")
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/francescomari/sdb/inspect"
+	"github.com/spf13/cobra"
+)
+
+func TestPagingFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    inspect.Pager
+		wantErr bool
+	}{
+		{nil, inspect.AllEntries(), false},
+		{[]string{"--skip", "2", "--limit", "3"}, inspect.Pager{Skip: 2, Limit: 3}, false},
+		{[]string{"--skip", "0"}, inspect.AllEntries(), false},
+		{[]string{"--skip", "-1"}, inspect.AllEntries(), true},
+		{[]string{"--limit", "-1"}, inspect.AllEntries(), true},
+		{[]string{"--skip", "x"}, inspect.AllEntries(), true},
+	}
+	for _, test := range tests {
+		p := inspect.AllEntries()
+		cmd := &cobra.Command{}
+		addPagingFlags(cmd, &p)
+		err := cmd.Flags().Parse(test.args)
+		if (err != nil) != test.wantErr {
+			t.Fatalf("%v: got error %v, want error %v", test.args, err, test.wantErr)
+		}
+		if err == nil && p != test.want {
+			t.Fatalf("%v: got %+v, want %+v", test.args, p, test.want)
+		}
+	}
+}
+
+func TestConflictingSegmentModes(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{[]string{"--count-records"}, false},
+		{[]string{"--record", "0", "--raw"}, false},
+		{[]string{"--count-records", "--record", "0"}, true},
+		{[]string{"--header", "--verify"}, true},
+		{[]string{"--record", "0", "--verify"}, true},
+	}
+	for _, test := range tests {
+		cmd := newSegmentCommand()
+		if err := cmd.ParseFlags(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.ValidateFlagGroups(); (err != nil) != test.wantErr {
+			t.Fatalf("%v: got error %v, want error %v", test.args, err, test.wantErr)
+		}
+	}
+}
+
+func TestConflictingGraphModes(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{[]string{"--orphans"}, false},
+		{[]string{"--reachable", "1111", "--depth", "1", "--show-depth"}, false},
+		{[]string{"--reverse", "--orphans"}, true},
+		{[]string{"--check-cycles", "--check-dangling"}, true},
+		{[]string{"--reachable", "1111", "--referrers", "2222"}, true},
+	}
+	for _, test := range tests {
+		cmd := newGraphCommand()
+		if err := cmd.ParseFlags(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.ValidateFlagGroups(); (err != nil) != test.wantErr {
+			t.Fatalf("%v: got error %v, want error %v", test.args, err, test.wantErr)
+		}
+	}
+}
+
+func TestGenerationFlags(t *testing.T) {
+	idx := testIndex("data00000a.tar", testStore()...)
+	tests := []struct {
+		name    string
+		args    []string
+		want    []testID
+		wantErr bool
+	}{
+		{"unset", nil, []testID{testA, testB, testC, testE}, false},
+		{"filtered", []string{"--generation", "2"}, []testID{testB, testC}, false},
+		{"empty", []string{"--generation", "9"}, nil, false},
+		{"negative", []string{"--generation", "-1"}, nil, true},
+		{"range", []string{"--min-generation", "2", "--max-generation", "3"}, []testID{testB, testC, testE}, false},
+		{"negative minimum", []string{"--min-generation", "-1"}, nil, true},
+		{"inverted range", []string{"--min-generation", "3", "--max-generation", "2"}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				cmd        = &cobra.Command{}
+				generation int
+				g          = anyGeneration()
+			)
+			addGenerationFlags(cmd, &generation, &g)
+			if err := cmd.ParseFlags(test.args); err != nil {
+				t.Fatal(err)
+			}
+			g, err := resolveGenerations(cmd, generation, g)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var b bytes.Buffer
+			v := inspect.IndexView{Keep: inspect.AllOf(g.indexFilter()), Page: inspect.AllEntries(), IDsOnly: true}
+			if err := inspect.PrintIndex(inspect.FormatText, v, &b)(idx.name, bytes.NewReader(idx.data)); err != nil {
+				t.Fatal(err)
+			}
+			var want strings.Builder
+			for _, id := range test.want {
+				want.WriteString(id.String() + "\n")
+			}
+			if b.String() != want.String() {
+				t.Fatalf("got\n%s\nwant\n%s", b.String(), want.String())
+			}
+		})
+	}
+}
+
+func TestSegmentsOfGeneration(t *testing.T) {
+	var (
+		segments = testStore()
+		entries  []testEntry
+	)
+	for _, s := range segments {
+		if s.id == testC {
+			entries = append(entries, s.rawEntry())
+		} else {
+			entries = append(entries, s.entry())
+		}
+	}
+	p := writeTestTar(t, "data00000a.tar", append(entries, testIndex("data00000a.tar", segments...))...)
+	idx, err := readIndex(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	warnings := withPolicy(t, true, func() {
+		if err := forEachMatchingEntry(p, isSegmentOfGeneration(exactGeneration(2), idx), doPrintSegmentNameTo(inspect.Notation{}, &b)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if warnings != "" {
+		t.Fatalf("unexpected warnings %q", warnings)
+	}
+	if want := "data " + testB.String() + "\nbulk " + testC.String() + "\n"; b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"regexp"
 	"strings"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
 )
 
 var segmentEntryRegexp = regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\\.[0-9a-f]{8}$")
@@ -29,10 +34,33 @@ func isAnySegment(n string) bool {
 
 func isSegment(id string) matcher {
 	return func(name string) bool {
-		return normalizeSegmentID(id) == normalizeSegmentID(entryNameToSegmentID(name))
+		return inspect.NormalizeSegmentID(id) == inspect.EntrySegmentID(name)
 	}
 }
 
-func entryNameToSegmentID(header string) string {
-	return header[:strings.Index(header, ".")]
+// isSegmentOfGeneration returns a matcher accepting the segments whose
+// generation, as recorded in 'idx', is in 'g'. The generation is taken from
+// the index because bulk segments don't have a header to read it from.
+// Segments that are not in the index are never accepted.
+func isSegmentOfGeneration(g generations, idx *index.Index) matcher {
+	return func(name string) bool {
+		if !isAnySegment(name) {
+			return false
+		}
+		e, ok := idx.Lookup(inspect.SegmentIDParts(inspect.EntrySegmentID(name)))
+		return ok && g.contains(e.Generation)
+	}
+}
+
+// reportingProgress returns a matcher behaving like 'm' that also prints the
+// number of entries seen so far to 'w', once every 'every' entries.
+func reportingProgress(m matcher, every int, w io.Writer) matcher {
+	n := 0
+	return func(name string) bool {
+		n++
+		if n%every == 0 {
+			fmt.Fprintf(w, "Processed %d entries.\n", n)
+		}
+		return m(name)
+	}
 }
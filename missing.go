@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/francescomari/sdb/inspect"
+	"github.com/francescomari/sdb/segment"
+)
+
+type missingReference struct {
+	From string
+	To   string
+}
+
+// readSegmentReferences adds the references stored in the data segments of
+// the TAR file at 'p' to the store.
+func (s *store) readSegmentReferences(p string) error {
+	return forEachMatchingEntry(p, isAnySegment, func(n string, r io.Reader) error {
+		from := inspect.EntrySegmentID(n)
+		if inspect.IsBulkSegmentID(from) {
+			return nil
+		}
+		var seg segment.Segment
+		if _, err := inspect.Parse(seg.ReadFrom, r); err != nil {
+			return err
+		}
+		for _, r := range seg.References {
+			s.references[from] = append(s.references[from], inspect.SegmentID(r.Msb, r.Lsb))
+		}
+		return nil
+	})
+}
+
+// missingReferences returns the references towards segments that are not in
+// the index of any TAR file of the store, sorted by the missing segment and
+// then by the referencing segment.
+func (s *store) missingReferences() []missingReference {
+	var (
+		missing []missingReference
+		seen    = make(map[missingReference]bool)
+	)
+	for from, refs := range s.references {
+		for _, to := range refs {
+			if _, ok := s.sizes[to]; ok {
+				continue
+			}
+			m := missingReference{from, to}
+			if !seen[m] {
+				seen[m] = true
+				missing = append(missing, m)
+			}
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		if missing[i].To != missing[j].To {
+			return missing[i].To < missing[j].To
+		}
+		return missing[i].From < missing[j].From
+	})
+	return missing
+}
+
+// printMissing prints the segments referenced in the TAR files at 'p' that are
+// not in the index of any of those TAR files, followed by the segment
+// referencing them. The references are read from the graphs and, if 'deep' is
+// true, from the data segments too. It returns the number of missing
+// references.
+func printMissing(p string, deep bool, nt inspect.Notation, w io.Writer) (int, error) {
+	paths, err := tarFilesIn(p, false)
+	if err != nil {
+		return 0, err
+	}
+	s := newStore()
+	for _, path := range paths {
+		if err := s.readFrom(path); err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		if !deep {
+			continue
+		}
+		if err := s.readSegmentReferences(path); err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	missing := s.missingReferences()
+	for _, m := range missing {
+		fmt.Fprintf(w, "%s %s\n", nt.ID(m.To), nt.ID(m.From))
+	}
+	return len(missing), nil
+}
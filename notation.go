@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/francescomari/sdb/inspect"
+	"github.com/spf13/cobra"
+)
+
+// withNotation returns the notation requested by the global flags.
+func withNotation(cmd *cobra.Command) inspect.Notation {
+	dashed, _ := cmd.Flags().GetBool("dashed")
+	upper, _ := cmd.Flags().GetBool("upper")
+	return inspect.Notation{Dashed: dashed, Upper: upper}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// outputFile is the temporary file 'f' the standard output is redirected to by
+// the --output flag, and the value 'path' of the flag. The temporary file is in
+// the same directory as 'path', so that it can be renamed atomically.
+type outputFile struct {
+	path string
+	f    *os.File
+}
+
+// pendingOutput is the output file of the running command, if any.
+var pendingOutput *outputFile
+
+// redirectOutput redirects the standard output to a temporary file, which is
+// renamed to 'path' by commitOutput. If 'path' already exists, it must be a
+// regular file, and the temporary file has the same permissions.
+func redirectOutput(path string) error {
+	mode := os.FileMode(0644)
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("%s is a directory", path)
+	case err == nil:
+		mode = info.Mode().Perm()
+	case !os.IsNotExist(err):
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	pendingOutput = &outputFile{path, f}
+	os.Stdout = f
+	return nil
+}
+
+// commitOutput renames the temporary file created by redirectOutput, if any,
+// to the path specified by the --output flag.
+func commitOutput() error {
+	if pendingOutput == nil {
+		return nil
+	}
+	o := pendingOutput
+	pendingOutput = nil
+	if err := o.f.Close(); err != nil {
+		os.Remove(o.f.Name())
+		return err
+	}
+	if err := os.Rename(o.f.Name(), o.path); err != nil {
+		os.Remove(o.f.Name())
+		return err
+	}
+	return nil
+}
+
+// discardOutput removes the temporary file created by redirectOutput, if any,
+// leaving the path specified by the --output flag untouched.
+func discardOutput() {
+	if pendingOutput == nil {
+		return
+	}
+	pendingOutput.f.Close()
+	os.Remove(pendingOutput.f.Name())
+	pendingOutput = nil
+}
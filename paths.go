@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
+	"github.com/spf13/cobra"
+)
+
+// tarFilesIn returns the TAR files at 'p'. A directory is expanded into the TAR
+// files it contains, sorted by name, or only into the most recent generation
+// of every TAR file if 'all' is false. Other paths, including '-' for the
+// standard input, are returned as they are.
+func tarFilesIn(p string, all bool) ([]string, error) {
+	if p == "-" {
+		return []string{p}, nil
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{p}, nil
+	}
+	var files []string
+	err = forEachTarFile(p, all, func(name string) {
+		files = append(files, filepath.Join(p, name))
+	})
+	return files, err
+}
+
+// forEachPath calls 'f' for every TAR file in 'paths', as expanded by
+// tarFilesIn. If there is more than one TAR file, the output for every file is
+// preceded by a header, unless the --no-header flag is set. A failure is
+// printed to standard error after 'msg', and doesn't stop the processing of
+// the other files. It returns the exit code of the first failure, or
+// exitSuccess if none of the paths failed.
+func forEachPath(cmd *cobra.Command, paths []string, msg string, f func(p string) error) int {
+	var (
+		files  []string
+		status exitStatus
+	)
+	for _, p := range paths {
+		found, err := tarFilesIn(p, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v.\n", msg, err)
+			status.fail(err)
+			continue
+		}
+		files = append(files, found...)
+	}
+	noHeader, _ := cmd.Flags().GetBool("no-header")
+	many := len(paths) > 1 || len(files) > 1
+	for i, p := range files {
+		if many && !noHeader {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %s <==\n", p)
+		}
+		if err := f(p); err != nil {
+			if many {
+				fmt.Fprintf(os.Stderr, "%s: %s: %v.\n", msg, p, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %v.\n", msg, err)
+			}
+			status.fail(err)
+		}
+	}
+	return int(status)
+}
+
+// readIndex returns an index with the entries of the indexes of the TAR files
+// at 'p', as expanded by tarFilesIn. If a segment is in more than one index,
+// its lookup returns the entry of the last one.
+func readIndex(p string) (*index.Index, error) {
+	files, err := tarFilesIn(p, true)
+	if err != nil {
+		return nil, err
+	}
+	var all index.Index
+	for _, file := range files {
+		err := onMatchingEntry(file, isIndex, requiring(func(_ string, r io.Reader) error {
+			var idx index.Index
+			if _, err := inspect.Parse(idx.ReadFrom, r); err != nil {
+				return err
+			}
+			all.Entries = append(all.Entries, idx.Entries...)
+			return nil
+		}))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return &all, nil
+}
+
+const progressInterval = 1000
+
+// withProgress wraps 'm' to report the progress of a scan on standard error if
+// the --progress flag is set.
+func withProgress(cmd *cobra.Command, m matcher) matcher {
+	if progress, _ := cmd.Flags().GetBool("progress"); progress {
+		return reportingProgress(m, progressInterval, os.Stderr)
+	}
+	return m
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTarFilesIn(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"data00000a.tar", "data00000b.tar", "data00001a.tar", "journal.log"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(dir, "data00000a.tar")
+	tests := []struct {
+		name string
+		p    string
+		all  bool
+		want []string
+	}{
+		{"all", dir, true, []string{"data00000a.tar", "data00000b.tar", "data00001a.tar"}},
+		{"most recent", dir, false, []string{"data00000b.tar", "data00001a.tar"}},
+		{"file", file, false, []string{file}},
+		{"standard input", "-", false, []string{"-"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := tarFilesIn(test.p, test.all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := test.want
+			if test.p == dir {
+				want = nil
+				for _, name := range test.want {
+					want = append(want, filepath.Join(dir, name))
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestIsSegment(t *testing.T) {
+	id := testA.String()
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{testSegment{id: testA}.entry().name, true},
+		{testSegment{id: testB}.entry().name, false},
+		{testA.uuid(), true},
+		{"data00000a.tar.idx", false},
+		{"unknown", false},
+	}
+	for _, test := range tests {
+		if got := isSegment(id)(test.name); got != test.want {
+			t.Fatalf("%q: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/francescomari/sdb/graph"
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
+)
+
+// store is the union of the indexes and graphs of a set of TAR files.
+type store struct {
+	sizes      map[string]int
+	references map[string][]string
+}
+
+func newStore() *store {
+	return &store{
+		sizes:      make(map[string]int),
+		references: make(map[string][]string),
+	}
+}
+
+func (s *store) readFrom(p string) error {
+	return forEachMatchingEntry(p, isIndexOrGraph, requiring(func(n string, r io.Reader) error {
+		if isIndex(n) {
+			var idx index.Index
+			if _, err := inspect.Parse(idx.ReadFrom, r); err != nil {
+				return err
+			}
+			for _, e := range idx.Entries {
+				s.sizes[inspect.SegmentID(e.Msb, e.Lsb)] = e.Size
+			}
+			return nil
+		}
+		var gph graph.Graph
+		if _, err := inspect.Parse(gph.ReadFrom, r); err != nil {
+			return err
+		}
+		for _, e := range gph.Entries {
+			from := inspect.SegmentID(e.Msb, e.Lsb)
+			for _, r := range e.References {
+				s.references[from] = append(s.references[from], inspect.SegmentID(r.Msb, r.Lsb))
+			}
+		}
+		return nil
+	}))
+}
+
+// reach visits the store breadth-first starting from the roots. It returns the
+// segments reached, including the roots, and the referenced segments that are
+// not in any index.
+func (s *store) reach(roots []string) (reached []reachedSegment, dangling []string, err error) {
+	var (
+		visited = make(map[string]bool)
+		queue   []reachedSegment
+	)
+	for _, root := range roots {
+		if _, ok := s.sizes[root]; !ok {
+			return nil, nil, fmt.Errorf("segment %s not found", root)
+		}
+		if !visited[root] {
+			visited[root] = true
+			queue = append(queue, reachedSegment{root, 0})
+		}
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		reached = append(reached, current)
+		for _, next := range s.references[current.ID] {
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if _, ok := s.sizes[next]; !ok {
+				dangling = append(dangling, next)
+				continue
+			}
+			queue = append(queue, reachedSegment{next, current.Depth + 1})
+		}
+	}
+	return reached, dangling, nil
+}
+
+// printReachable prints the segments reachable from the roots in the TAR files
+// at 'p', or the unreachable ones if 'invert' is true. The output is followed
+// by the dangling references and a summary of the reachable segments.
+func printReachable(p string, roots []string, invert bool, nt inspect.Notation, w io.Writer) error {
+	paths, err := tarFilesIn(p, false)
+	if err != nil {
+		return err
+	}
+	s := newStore()
+	for _, path := range paths {
+		if err := s.readFrom(path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	reached, dangling, err := s.reach(roots)
+	if err != nil {
+		return err
+	}
+	var (
+		isReached = make(map[string]bool)
+		bytes     int
+		total     int
+	)
+	for _, r := range reached {
+		isReached[r.ID] = true
+		bytes += s.sizes[r.ID]
+	}
+	for _, size := range s.sizes {
+		total += size
+	}
+	if invert {
+		var ids []string
+		for id := range s.sizes {
+			if !isReached[id] {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Fprintln(w, nt.ID(id))
+		}
+	} else {
+		for _, r := range reached {
+			fmt.Fprintf(w, "%s %d\n", nt.ID(r.ID), r.Depth)
+		}
+	}
+	for _, id := range dangling {
+		fmt.Fprintf(w, "dangling %s\n", nt.ID(id))
+	}
+	fmt.Fprintf(w, "reachable %d/%d segments %d/%d bytes\n", len(reached), len(s.sizes), bytes, total)
+	return nil
+}
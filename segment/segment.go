@@ -15,6 +15,8 @@ type Segment struct {
 	Compacted      bool
 	References     []Reference
 	Records        []Record
+
+	data []byte
 }
 
 // A Reference represents a link towards another segment.
@@ -73,6 +75,33 @@ const (
 	v13 = 13
 )
 
+// Size returns the number of bytes of the segment.
+func (segment *Segment) Size() int {
+	return len(segment.data)
+}
+
+// HeaderSize returns the number of bytes taken by the header of the segment,
+// including the tables of the references and of the records. The content of
+// the records is stored after the header.
+func (segment *Segment) HeaderSize() int {
+	const (
+		headerSize    = 32
+		referenceSize = 16
+		recordSize    = 9
+	)
+
+	return headerSize + len(segment.References)*referenceSize + len(segment.Records)*recordSize
+}
+
+// HeaderData returns the bytes of the header of the segment, including the
+// tables of the references and of the records.
+func (segment *Segment) HeaderData() []byte {
+	if n := segment.HeaderSize(); n < len(segment.data) {
+		return segment.data[:n]
+	}
+	return segment.data
+}
+
 func (segment *Segment) parseFrom(data []byte) error {
 	if len(data) < 4 {
 		return fmt.Errorf("invalid data")
@@ -147,6 +176,7 @@ func (segment *Segment) parsev12From(data []byte) error {
 	segment.FullGeneration = generation
 	segment.Compacted = true
 	segment.Version = version
+	segment.data = data
 	segment.References = make([]Reference, nreferences)
 	segment.Records = make([]Record, nrecords)
 
@@ -226,6 +256,7 @@ func (segment *Segment) parsev13From(data []byte) error {
 	segment.FullGeneration = fullGeneration
 	segment.Compacted = compacted
 	segment.Version = version
+	segment.data = data
 	segment.References = make([]Reference, nreferences)
 	segment.Records = make([]Record, nrecords)
 
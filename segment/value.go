@@ -0,0 +1,261 @@
+package segment
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// MaxSize is the maximum size of a segment. The offsets of the records are
+// relative to the end of a segment of this size.
+const MaxSize = 256 * 1024
+
+const recordIDSize = 6
+
+// A RecordID identifies a record, possibly stored in a different segment.
+type RecordID struct {
+	// Segment is zero if the record is stored in the same segment, or the
+	// number of the reference towards the segment containing the record,
+	// starting from one.
+	Segment int
+	// Number is the number of the record in its segment.
+	Number int
+}
+
+// A ValueKind is the way the content of a value is stored.
+type ValueKind int
+
+const (
+	// ValueKindInline is the kind of a value stored in the record itself.
+	ValueKindInline ValueKind = iota
+	// ValueKindLong is the kind of a value stored in a list of block records.
+	ValueKindLong
+	// ValueKindBlobID is the kind of a blob ID stored in the record itself.
+	ValueKindBlobID
+	// ValueKindLongBlobID is the kind of a blob ID stored in a separate value
+	// record.
+	ValueKindLongBlobID
+)
+
+// A Value is the decoded content of a value or blob ID record.
+type Value struct {
+	Kind ValueKind
+	// Length is the length of the value in bytes. It is zero for values of
+	// kind ValueKindLongBlobID.
+	Length int64
+	// Data is the content of the value. It is only set for values of kind
+	// ValueKindInline and ValueKindBlobID.
+	Data []byte
+	// Reference points to the list of blocks of a value of kind
+	// ValueKindLong, or to the value record of a blob ID of kind
+	// ValueKindLongBlobID.
+	Reference RecordID
+}
+
+func (segment *Segment) recordData(r Record) ([]byte, error) {
+	position := len(segment.data) - (MaxSize - r.Offset)
+
+	if r.Offset > MaxSize || position < 0 || position >= len(segment.data) {
+		return nil, fmt.Errorf("record %x: offset %x out of bounds", r.Number, r.Offset)
+	}
+
+	return segment.data[position:], nil
+}
+
+func readRecordID(data []byte) RecordID {
+	return RecordID{
+		Segment: int(binary.BigEndian.Uint16(data)),
+		Number:  int(binary.BigEndian.Uint32(data[2:])),
+	}
+}
+
+// Value decodes the content of a value or blob ID record. It returns an error
+// if the record is out of the bounds of the segment or if its length header is
+// malformed.
+func (segment *Segment) Value(r Record) (Value, error) {
+	data, err := segment.recordData(r)
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	tooShort := fmt.Errorf("record %x: not enough data", r.Number)
+
+	switch head := data[0]; {
+	case head&0x80 == 0:
+		n := int(head)
+		if len(data) < 1+n {
+			return Value{}, tooShort
+		}
+		return Value{Kind: ValueKindInline, Length: int64(n), Data: data[1 : 1+n]}, nil
+	case head&0xc0 == 0x80:
+		if len(data) < 2 {
+			return Value{}, tooShort
+		}
+		n := int(binary.BigEndian.Uint16(data)&0x3fff) + 0x80
+		if len(data) < 2+n {
+			return Value{}, tooShort
+		}
+		return Value{Kind: ValueKindInline, Length: int64(n), Data: data[2 : 2+n]}, nil
+	case head&0xe0 == 0xc0:
+		if len(data) < 8+recordIDSize {
+			return Value{}, tooShort
+		}
+		n := int64(binary.BigEndian.Uint64(data)&0x1fffffffffffffff) + 0x4080
+		return Value{Kind: ValueKindLong, Length: n, Reference: readRecordID(data[8:])}, nil
+	case head&0xf0 == 0xe0:
+		if len(data) < 2 {
+			return Value{}, tooShort
+		}
+		n := int(binary.BigEndian.Uint16(data) & 0x0fff)
+		if len(data) < 2+n {
+			return Value{}, tooShort
+		}
+		return Value{Kind: ValueKindBlobID, Length: int64(n), Data: data[2 : 2+n]}, nil
+	case head&0xf8 == 0xf0:
+		if len(data) < 1+recordIDSize {
+			return Value{}, tooShort
+		}
+		return Value{Kind: ValueKindLongBlobID, Reference: readRecordID(data[1:])}, nil
+	default:
+		return Value{}, fmt.Errorf("record %x: invalid length header %02x", r.Number, head)
+	}
+}
+
+// RecordSizes returns the size of every record, in the same order as Records.
+// The size of a record is the distance between its offset and the next higher
+// offset, or the end of the segment for the record with the highest offset. The
+// size is negative if it can't be determined, because the offset is shared with
+// another record or it is out of bounds.
+func (segment *Segment) RecordSizes() []int {
+	offsets := make([]int, 0, len(segment.Records))
+	count := make(map[int]int)
+	for _, r := range segment.Records {
+		if count[r.Offset] == 0 {
+			offsets = append(offsets, r.Offset)
+		}
+		count[r.Offset]++
+	}
+	sort.Ints(offsets)
+	next := make(map[int]int)
+	for i, o := range offsets {
+		if i+1 < len(offsets) {
+			next[o] = offsets[i+1]
+		} else {
+			next[o] = MaxSize
+		}
+	}
+	sizes := make([]int, len(segment.Records))
+	for i, r := range segment.Records {
+		if count[r.Offset] > 1 || r.Offset < 0 || r.Offset >= MaxSize {
+			sizes[i] = -1
+			continue
+		}
+		sizes[i] = next[r.Offset] - r.Offset
+	}
+	return sizes
+}
+
+// RecordData returns the bytes of a record, from its offset to the next higher
+// offset, or to the end of the segment for the record with the highest offset.
+func (segment *Segment) RecordData(r Record) ([]byte, error) {
+	data, err := segment.recordData(r)
+	if err != nil {
+		return nil, err
+	}
+	next := MaxSize
+	for _, o := range segment.Records {
+		if o.Offset > r.Offset && o.Offset < next {
+			next = o.Offset
+		}
+	}
+	if size := next - r.Offset; size < len(data) {
+		data = data[:size]
+	}
+	return data, nil
+}
+
+// mapSizeBits is the number of bits of the header of a map record storing the
+// size of the map. The remaining bits store the level of the record.
+const mapSizeBits = 28
+
+// diffMapHeader is the header of a map branch storing a single change to a
+// base map.
+const diffMapHeader = 0xffffffff
+
+func readRecordIDs(data []byte, n int) []RecordID {
+	ids := make([]RecordID, n)
+	for i := range ids {
+		ids[i] = readRecordID(data[i*recordIDSize:])
+	}
+	return ids
+}
+
+// RecordReferences decodes the record IDs embedded in a node, list, list
+// bucket, map leaf or map branch record. Only the stable ID and the template of
+// a node are decoded, because the rest of a node record can't be interpreted
+// without its template. It returns no record IDs for the other types of
+// records, and an error if the record is out of the bounds of the segment or
+// too short.
+func (segment *Segment) RecordReferences(r Record) ([]RecordID, error) {
+	switch r.Type {
+	case RecordTypeNode, RecordTypeList, RecordTypeListBucket, RecordTypeMapLeaf, RecordTypeMapBranch:
+	default:
+		return nil, nil
+	}
+
+	data, err := segment.RecordData(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tooShort := fmt.Errorf("record %x: not enough data", r.Number)
+
+	// ids returns 'n' record IDs starting at 'offset'.
+	ids := func(offset, n int) ([]RecordID, error) {
+		if n < 0 || len(data) < offset+n*recordIDSize {
+			return nil, tooShort
+		}
+		return readRecordIDs(data[offset:], n), nil
+	}
+
+	switch r.Type {
+	case RecordTypeNode:
+		return ids(0, 2)
+	case RecordTypeList:
+		if len(data) < 4 {
+			return nil, tooShort
+		}
+		if binary.BigEndian.Uint32(data) == 0 {
+			return nil, nil
+		}
+		return ids(4, 1)
+	case RecordTypeListBucket:
+		return ids(0, len(data)/recordIDSize)
+	}
+
+	if len(data) < 4 {
+		return nil, tooShort
+	}
+
+	head := binary.BigEndian.Uint32(data)
+
+	if r.Type == RecordTypeMapLeaf {
+		size := int(head & (1<<mapSizeBits - 1))
+		return ids(4+4*size, 2*size)
+	}
+
+	if len(data) < 8 {
+		return nil, tooShort
+	}
+
+	if head == diffMapHeader {
+		return ids(8, 3)
+	}
+
+	bitmap := binary.BigEndian.Uint32(data[4:])
+
+	return ids(8, bits.OnesCount32(bitmap))
+}
@@ -0,0 +1,31 @@
+package segment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordSizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets []int
+		want    []int
+	}{
+		{"ordered", []int{MaxSize - 20, MaxSize - 12, MaxSize - 4}, []int{8, 8, 4}},
+		{"unordered", []int{MaxSize - 4, MaxSize - 20, MaxSize - 12}, []int{4, 8, 8}},
+		{"shared offset", []int{MaxSize - 20, MaxSize - 20, MaxSize - 4}, []int{-1, -1, 4}},
+		{"out of bounds", []int{MaxSize - 20, MaxSize, -1}, []int{20, -1, -1}},
+		{"empty", nil, []int{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var s Segment
+			for i, o := range test.offsets {
+				s.Records = append(s.Records, Record{Number: i, Type: RecordTypeValue, Offset: o})
+			}
+			if got := s.RecordSizes(); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
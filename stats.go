@@ -0,0 +1,325 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
+	"github.com/francescomari/sdb/segment"
+)
+
+// formatSize prints a size in bytes, or in binary multiples if 'human' is true.
+func formatSize(n int, human bool) string {
+	if human {
+		return inspect.HumanSize(n)
+	}
+	return strconv.Itoa(n)
+}
+
+// formatMeanSize prints a mean size with two decimal digits, or rounded to the
+// closest byte and in binary multiples if 'human' is true.
+func formatMeanSize(n float64, human bool) string {
+	if human {
+		return inspect.HumanSize(int(math.Round(n)))
+	}
+	return strconv.FormatFloat(n, 'f', 2, 64)
+}
+
+type indexStats struct {
+	Entries     int         `json:"entries"`
+	Size        int         `json:"size"`
+	Data        int         `json:"data"`
+	Bulk        int         `json:"bulk"`
+	MinSize     int         `json:"minSize"`
+	MaxSize     int         `json:"maxSize"`
+	MeanSize    float64     `json:"meanSize"`
+	Generations map[int]int `json:"generations"`
+}
+
+func newIndexStats(entries []index.Entry) indexStats {
+	s := indexStats{Generations: make(map[int]int)}
+	for _, e := range entries {
+		s.Generations[e.Generation]++
+		if s.Entries == 0 || e.Size < s.MinSize {
+			s.MinSize = e.Size
+		}
+		if e.Size > s.MaxSize {
+			s.MaxSize = e.Size
+		}
+		if inspect.IsBulkSegmentID(inspect.SegmentID(e.Msb, e.Lsb)) {
+			s.Bulk++
+		} else {
+			s.Data++
+		}
+		s.Entries++
+		s.Size += e.Size
+	}
+	if s.Entries > 0 {
+		s.MeanSize = float64(s.Size) / float64(s.Entries)
+	}
+	return s
+}
+
+func doPrintIndexStats(f inspect.Format, v inspect.IndexView, w io.Writer) handler {
+	switch f {
+	case inspect.FormatText:
+		return doPrintIndexStatsTo(v, w)
+	case inspect.FormatJSON:
+		return doPrintIndexStatsJSONTo(v, w)
+	default:
+		return inspect.InvalidFormat()
+	}
+}
+
+func doPrintIndexStatsTo(v inspect.IndexView, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var idx index.Index
+		if _, err := inspect.Parse(idx.ReadFrom, r); err != nil {
+			return err
+		}
+		s := newIndexStats(v.Entries(&idx))
+		fmt.Fprintf(w, "entries %d\n", s.Entries)
+		fmt.Fprintf(w, "size %s\n", formatSize(s.Size, v.Human))
+		fmt.Fprintf(w, "data %d\n", s.Data)
+		fmt.Fprintf(w, "bulk %d\n", s.Bulk)
+		fmt.Fprintf(w, "minSize %s\n", formatSize(s.MinSize, v.Human))
+		fmt.Fprintf(w, "maxSize %s\n", formatSize(s.MaxSize, v.Human))
+		fmt.Fprintf(w, "meanSize %s\n", formatMeanSize(s.MeanSize, v.Human))
+		var gs []int
+		for g := range s.Generations {
+			gs = append(gs, g)
+		}
+		sort.Ints(gs)
+		for _, g := range gs {
+			fmt.Fprintf(w, "generation %d %d\n", g, s.Generations[g])
+		}
+		return nil
+	}
+}
+
+func doPrintIndexStatsJSONTo(v inspect.IndexView, w io.Writer) handler {
+	return func(_ string, r io.Reader) error {
+		var idx index.Index
+		if _, err := inspect.Parse(idx.ReadFrom, r); err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(newIndexStats(v.Entries(&idx)))
+	}
+}
+
+type tarStats struct {
+	Segments    int            `json:"segments"`
+	Data        int            `json:"data"`
+	Bulk        int            `json:"bulk"`
+	DataSize    int            `json:"dataSize"`
+	BulkSize    int            `json:"bulkSize"`
+	MinSize     int            `json:"minSize"`
+	MaxSize     int            `json:"maxSize"`
+	MeanSize    float64        `json:"meanSize"`
+	Records     map[string]int `json:"records"`
+	Generations []int          `json:"generations"`
+}
+
+func newTarStats() *tarStats {
+	return &tarStats{Records: make(map[string]int), Generations: []int{}}
+}
+
+func (s *tarStats) addSegment(size int) {
+	if s.Segments == 0 || size < s.MinSize {
+		s.MinSize = size
+	}
+	if size > s.MaxSize {
+		s.MaxSize = size
+	}
+	s.Segments++
+	s.MeanSize = float64(s.DataSize+s.BulkSize) / float64(s.Segments)
+}
+
+func (s *tarStats) addGeneration(g int) {
+	i := sort.SearchInts(s.Generations, g)
+	if i < len(s.Generations) && s.Generations[i] == g {
+		return
+	}
+	s.Generations = append(s.Generations, 0)
+	copy(s.Generations[i+1:], s.Generations[i:])
+	s.Generations[i] = g
+}
+
+func doCollectStats(s *tarStats) entryHandler {
+	return func(hdr *tar.Header, r io.Reader) error {
+		id := inspect.EntrySegmentID(hdr.Name)
+		if inspect.IsBulkSegmentID(id) {
+			s.Bulk++
+			s.BulkSize += int(hdr.Size)
+			s.addSegment(int(hdr.Size))
+			return nil
+		}
+		var sgm segment.Segment
+		size, err := inspect.Parse(sgm.ReadFrom, r)
+		if err != nil {
+			return err
+		}
+		s.Data++
+		s.DataSize += int(size)
+		s.addSegment(int(size))
+		s.addGeneration(sgm.Generation)
+		for _, r := range sgm.Records {
+			s.Records[inspect.RecordType(r.Type)]++
+		}
+		return nil
+	}
+}
+
+func printTarStats(f inspect.Format, s *tarStats, human bool, w io.Writer) error {
+	switch f {
+	case inspect.FormatText:
+		return printTarStatsTo(s, human, w)
+	case inspect.FormatJSON:
+		return json.NewEncoder(w).Encode(s)
+	default:
+		return inspect.ErrInvalidFormat
+	}
+}
+
+func printTarStatsTo(s *tarStats, human bool, w io.Writer) error {
+	fmt.Fprintf(w, "segments %d\n", s.Segments)
+	fmt.Fprintf(w, "data %d\n", s.Data)
+	fmt.Fprintf(w, "bulk %d\n", s.Bulk)
+	fmt.Fprintf(w, "dataSize %s\n", formatSize(s.DataSize, human))
+	fmt.Fprintf(w, "bulkSize %s\n", formatSize(s.BulkSize, human))
+	fmt.Fprintf(w, "minSize %s\n", formatSize(s.MinSize, human))
+	fmt.Fprintf(w, "maxSize %s\n", formatSize(s.MaxSize, human))
+	fmt.Fprintf(w, "meanSize %s\n", formatMeanSize(s.MeanSize, human))
+	var types []string
+	for t := range s.Records {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		fmt.Fprintf(w, "records %s %d\n", t, s.Records[t])
+	}
+	for _, g := range s.Generations {
+		fmt.Fprintf(w, "generation %d\n", g)
+	}
+	return nil
+}
+
+// tarRecordCounts is the number of records of every type in the data segments
+// of a TAR file.
+type tarRecordCounts struct {
+	Types map[string]int `json:"types"`
+	Total int            `json:"total"`
+}
+
+func newTarRecordCounts() *tarRecordCounts {
+	return &tarRecordCounts{Types: make(map[string]int)}
+}
+
+func doCollectRecordCounts(c *tarRecordCounts) handler {
+	return func(n string, r io.Reader) error {
+		if inspect.IsBulkSegmentID(inspect.EntrySegmentID(n)) {
+			return nil
+		}
+		var s segment.Segment
+		if _, err := inspect.Parse(s.ReadFrom, r); err != nil {
+			return err
+		}
+		for _, r := range s.Records {
+			c.Types[inspect.RecordType(r.Type)]++
+			c.Total++
+		}
+		return nil
+	}
+}
+
+func printTarRecordCounts(f inspect.Format, c *tarRecordCounts, w io.Writer) error {
+	switch f {
+	case inspect.FormatText:
+		return printTarRecordCountsTo(c, w)
+	case inspect.FormatJSON:
+		return json.NewEncoder(w).Encode(c)
+	default:
+		return inspect.ErrInvalidFormat
+	}
+}
+
+// printTarRecordCountsTo prints the number of records of every type and their
+// percentage of the total, most frequent types first, followed by the total.
+func printTarRecordCountsTo(c *tarRecordCounts, w io.Writer) error {
+	var types []string
+	for t := range c.Types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if c.Types[types[i]] != c.Types[types[j]] {
+			return c.Types[types[i]] > c.Types[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	for _, t := range types {
+		fmt.Fprintf(w, "%s %d %.2f%%\n", t, c.Types[t], 100*float64(c.Types[t])/float64(c.Total))
+	}
+	fmt.Fprintf(w, "total %d\n", c.Total)
+	return nil
+}
+
+// tarSizes is the total size of the entries of one or more TAR files, grouped
+// by kind.
+type tarSizes struct {
+	Index    int64
+	Graph    int64
+	Binaries int64
+	Data     int64
+	Bulk     int64
+	Other    int64
+}
+
+func (s *tarSizes) total() int64 {
+	return s.Index + s.Graph + s.Binaries + s.Data + s.Bulk + s.Other
+}
+
+func (s *tarSizes) add(o *tarSizes) {
+	s.Index += o.Index
+	s.Graph += o.Graph
+	s.Binaries += o.Binaries
+	s.Data += o.Data
+	s.Bulk += o.Bulk
+	s.Other += o.Other
+}
+
+func doCollectSizes(s *tarSizes) entryHandler {
+	return func(hdr *tar.Header, _ io.Reader) error {
+		var (
+			n    = hdr.Name
+			size = hdr.Size
+		)
+		switch {
+		case isIndex(n):
+			s.Index += size
+		case isGraph(n):
+			s.Graph += size
+		case isBinary(n):
+			s.Binaries += size
+		case isAnySegment(n) && inspect.IsBulkSegmentID(inspect.EntrySegmentID(n)):
+			s.Bulk += size
+		case isAnySegment(n):
+			s.Data += size
+		default:
+			s.Other += size
+		}
+		return nil
+	}
+}
+
+func printTarSizes(name string, s *tarSizes, human bool, w io.Writer) {
+	size := func(n int64) string {
+		return formatSize(int(n), human)
+	}
+	fmt.Fprintf(w, "index %s graph %s binaries %s data %s bulk %s other %s total %s %s\n", size(s.Index), size(s.Graph), size(s.Binaries), size(s.Data), size(s.Bulk), size(s.Other), size(s.total()), name)
+}
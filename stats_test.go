@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/francescomari/sdb/inspect"
+)
+
+func TestCollectSizes(t *testing.T) {
+	var (
+		segments = testStore()
+		data     = segments[0].entry()
+		bulk     = compressed(segments[2].entry())
+		idx      = compressed(testIndex("data00000a.tar", segments...))
+		gph      = testGraph("data00000a.tar", segments...)
+		unknown  = testEntry{"unknown", []byte("data")}
+		p        = writeTestTar(t, "data00000a.tar", data, bulk, gph, idx, unknown)
+	)
+	var s tarSizes
+	withPolicy(t, false, func() {
+		if err := forEachMatchingEntryHeader(p, any, doCollectSizes(&s)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want := tarSizes{
+		Index: int64(len(idx.data)),
+		Graph: int64(len(gph.data)),
+		Data:  int64(len(data.data)),
+		Bulk:  int64(len(bulk.data)),
+		Other: int64(len(unknown.data)),
+	}
+	if s != want {
+		t.Fatalf("got %+v, want %+v", s, want)
+	}
+}
+
+func TestCollectStatsBulkSize(t *testing.T) {
+	var (
+		segments = testStore()
+		data     = segments[0].entry()
+		bulk     = segments[2].entry()
+		p        = writeTestTar(t, "data00000a.tar", data, bulk)
+		s        = newTarStats()
+	)
+	if err := forEachMatchingEntryHeader(p, isAnySegment, doCollectStats(s)); err != nil {
+		t.Fatal(err)
+	}
+	if s.Bulk != 1 || s.BulkSize != len(bulk.data) {
+		t.Fatalf("got %d bulk segments of %d bytes, want 1 of %d bytes", s.Bulk, s.BulkSize, len(bulk.data))
+	}
+	if s.Data != 1 || s.DataSize != len(data.data) {
+		t.Fatalf("got %d data segments of %d bytes, want 1 of %d bytes", s.Data, s.DataSize, len(data.data))
+	}
+	if s.Segments != 2 {
+		t.Fatalf("got %d segments, want 2", s.Segments)
+	}
+}
+
+func TestPrintIndexStats(t *testing.T) {
+	var (
+		idx = testIndex("data00000a.tar", testStore()...)
+		v   = inspect.IndexView{Keep: inspect.AllOf(), Page: inspect.AllEntries()}
+	)
+	tests := []struct {
+		format inspect.Format
+		want   string
+	}{
+		{
+			format: inspect.FormatText,
+			want: "" +
+				"entries 4\n" +
+				"size 335\n" +
+				"data 3\n" +
+				"bulk 1\n" +
+				"minSize 60\n" +
+				"maxSize 105\n" +
+				"meanSize 83.75\n" +
+				"generation 1 1\n" +
+				"generation 2 2\n" +
+				"generation 3 1\n",
+		},
+		{
+			format: inspect.FormatJSON,
+			want:   `{"entries":4,"size":335,"data":3,"bulk":1,"minSize":60,"maxSize":105,"meanSize":83.75,"generations":{"1":1,"2":2,"3":1}}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.format.String(), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := doPrintIndexStats(test.format, v, &b)(idx.name, bytes.NewReader(idx.data)); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != test.want {
+				t.Fatalf("got\n%s\nwant\n%s", b.String(), test.want)
+			}
+		})
+	}
+}
@@ -2,43 +2,332 @@ package main
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"sync"
+
+	"github.com/francescomari/sdb/inspect"
 )
 
-type handler func(n string, r io.Reader) error
+type handler = inspect.Handler
 
 type matcher func(string) bool
 
 var errStop = errors.New("stop")
 
-func forEachMatchingEntry(p string, m matcher, h handler) error {
-	f, err := os.Open(p)
+// openTarFile opens the TAR file at 'p', or the standard input if 'p' is '-'.
+// If the TAR file is compressed with gzip, it is decompressed transparently.
+func openTarFile(p string) (io.ReadCloser, error) {
+	var f = ioutil.NopCloser(os.Stdin)
+	if p != "-" {
+		file, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		f = file
+	}
+	r, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	if _, ok := r.(*gzip.Reader); ok {
+		r = &namedReader{r, p}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// namedReader prefixes the errors returned by a reader with a name, except
+// io.EOF.
+type namedReader struct {
+	r    io.Reader
+	name string
+}
+
+func (n *namedReader) Read(p []byte) (int, error) {
+	c, err := n.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%s: %v", n.name, err)
+	}
+	return c, err
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// autoDecompress enables the detection of gzip-compressed TAR files and
+// entries. It is disabled by the --no-decompress flag.
+var autoDecompress = true
+
+// decompress returns a reader decompressing the content of 'r' if it starts
+// with the gzip magic number, or a reader returning the content of 'r'
+// unchanged otherwise. If autoDecompress is false, the content of 'r' is
+// always returned unchanged.
+func decompress(r io.Reader) (io.Reader, error) {
+	if !autoDecompress {
+		return r, nil
+	}
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// errorPolicy decides what happens when an entry of a TAR file can't be parsed
+// or has an unknown name. In strict mode, the processing of the TAR file stops
+// with an error naming the entry and the offset where parsing stopped.
+// Otherwise, a warning is printed to 'w', the processing continues with the
+// next entries, and the entry is counted as skipped, so that the command can
+// still fail once it's done.
+type errorPolicy struct {
+	strict bool
+	w      io.Writer
+
+	mu      sync.Mutex
+	skipped int
+}
+
+// entryPolicy is the error policy used when processing the entries of TAR
+// files. It is strict if the --strict flag is set.
+var entryPolicy = &errorPolicy{w: os.Stderr}
+
+// requiredEntryError is returned by handlers reading an entry, like the index
+// or the graph, without which the command can't produce a correct result.
+type requiredEntryError struct {
+	err error
+}
+
+func (e *requiredEntryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requiredEntryError) Unwrap() error {
+	return e.err
+}
+
+// requiring returns a handler behaving like 'h', for entries that the command
+// can't do without. The errors of required entries are never skipped, even if
+// the policy is not strict, because continuing would compute results from an
+// incomplete index or graph.
+func requiring(h handler) handler {
+	return func(n string, r io.Reader) error {
+		err := h(n, r)
+		if err == nil || err == errStop {
+			return err
+		}
+		return &requiredEntryError{err}
+	}
+}
+
+// onEntryError handles the error returned while processing the entry 'n' of the
+// TAR file at 'p'. 'offset' is the offset in the TAR file where the processing
+// stopped. Only parse errors of entries that are not required are subject to
+// the policy, the other errors are always returned.
+func (e *errorPolicy) onEntryError(p, n string, offset int64, err error) error {
+	var (
+		parseErr    *inspect.ParseError
+		requiredErr *requiredEntryError
+	)
+	if !errors.As(err, &parseErr) {
+		return fmt.Errorf("%s: %w", n, err)
+	}
+	if e.strict || errors.As(err, &requiredErr) {
+		return fmt.Errorf("%s: offset %d: %w", n, offset, err)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.skipped++
+	fmt.Fprintf(e.w, "Warning: %s: %s: offset %d: %v.\n", p, n, offset, err)
+	return nil
+}
+
+// onUnknownEntry handles an entry whose name doesn't identify a segment, an
+// index, a graph or an index of binary references.
+func (e *errorPolicy) onUnknownEntry(p, n string, offset int64) error {
+	return e.onEntryError(p, n, offset, &inspect.ParseError{Err: errors.New("unknown entry")})
+}
+
+// skippedEntries returns the number of entries skipped because of a parse
+// error.
+func (e *errorPolicy) skippedEntries() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.skipped
+}
+
+// onTarError handles an error reading the structure of a TAR file. The
+// processing of the TAR file can't continue, so the error is always returned,
+// as a parse error.
+func (e *errorPolicy) onTarError(offset int64, err error) error {
+	if e.strict {
+		err = fmt.Errorf("offset %d: %v", offset, err)
+	}
+	return &inspect.ParseError{Err: err}
+}
+
+// maxEntrySize is the maximum size of the content of an entry. The TAR files
+// of a segment store are much smaller than this, so a larger size means that
+// the header of the entry is corrupted. Checking the size prevents handlers
+// that read the whole content of an entry from exhausting the memory.
+const maxEntrySize = 1 << 30
+
+func isKnownEntry(n string) bool {
+	return isAnySegment(n) || isIndex(n) || isGraph(n) || isBinary(n)
+}
+
+// errorReader fails every read with 'err'. It replaces the content of an entry
+// that can't be decompressed, so that the error is reported by the handler
+// reading the content, like any other error reading an entry.
+type errorReader struct {
+	err error
+}
+
+func (e errorReader) Read(_ []byte) (int, error) {
+	return 0, e.err
+}
+
+// entryReader counts the bytes read from the content of an entry, and
+// remembers the first error other than io.EOF.
+type entryReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (e *entryReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	e.n += int64(n)
+	if err != nil && err != io.EOF && e.err == nil {
+		e.err = err
+	}
+	return n, err
+}
+
+// handleEntry calls 'h' on the content of the entry 'n' of the TAR file at 'p',
+// read from 'r'. 'offset' is the offset of the content in the TAR file. The
+// errors returned by 'h' are handled by entryPolicy. Errors reading the content
+// are handled as parse errors, even if 'h' doesn't report them as such.
+func handleEntry(p, n string, offset int64, r io.Reader, h handler) error {
+	er := &entryReader{r: r}
+	err := h(n, er)
+	if err == nil || err == errStop {
+		return err
+	}
+	var parseErr *inspect.ParseError
+	if !errors.As(err, &parseErr) && er.err != nil {
+		err = &inspect.ParseError{Err: err}
+	}
+	return entryPolicy.onEntryError(p, n, offset+er.n, err)
+}
+
+// isCompressible returns true if the entry 'n' may be compressed. Only the
+// entries in a known format can be recognized as compressed. The content of a
+// bulk segment is arbitrary binary data, which may start with the gzip magic
+// number by chance, so it is never decompressed.
+func isCompressible(n string) bool {
+	if isAnySegment(n) {
+		return !inspect.IsBulkSegmentID(inspect.EntrySegmentID(n))
+	}
+	return isIndex(n) || isGraph(n) || isBinary(n)
+}
+
+// entryContent returns the content of the entry 'hdr', read from 'r' and
+// decompressed if needed. If the entry is too large or can't be decompressed,
+// the content fails with an error when it is read.
+func entryContent(hdr *tar.Header, r io.Reader) io.Reader {
+	if hdr.Size > maxEntrySize {
+		return errorReader{fmt.Errorf("entry too large: %d bytes, the maximum is %d bytes", hdr.Size, maxEntrySize)}
+	}
+	if !isCompressible(hdr.Name) {
+		return r
+	}
+	dr, err := decompress(r)
+	if err != nil {
+		return errorReader{err}
+	}
+	return dr
+}
+
+// walkTarFile calls 'h' on the header and the content of the entries of the
+// TAR file at 'p' matching 'm', together with the offset of the content in the TAR file. If
+// the TAR file is compressed, the offset is relative to the decompressed TAR
+// file.
+func walkTarFile(p string, m matcher, h func(hdr *tar.Header, offset int64, r io.Reader) error) error {
+	f, err := openTarFile(p)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	r := tar.NewReader(f)
+	cr := &countingReader{r: f}
+	r := tar.NewReader(cr)
 	for {
 		hdr, err := r.Next()
-		if hdr == nil {
+		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return err
+			return entryPolicy.onTarError(cr.n, err)
 		}
-		if m(hdr.Name) {
-			if err := h(hdr.Name, r); err == errStop {
-				return nil
-			} else if err != nil {
+		offset := cr.n
+		if !isKnownEntry(hdr.Name) {
+			if err := entryPolicy.onUnknownEntry(p, hdr.Name, offset); err != nil {
 				return err
 			}
 		}
+		if !m(hdr.Name) {
+			continue
+		}
+		if err := h(hdr, offset, entryContent(hdr, r)); err == errStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	// Read what follows the end of the archive, so that the integrity of a
+	// compressed TAR file is verified.
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return entryPolicy.onTarError(cr.n, err)
 	}
 	return nil
 }
 
+// forEachMatchingEntry calls 'h' on the entries of the TAR file at 'p' matching
+// 'm'. The errors returned by 'h' are handled by entryPolicy. If 'h' returns
+// errStop, the remaining entries are skipped.
+func forEachMatchingEntry(p string, m matcher, h handler) error {
+	return walkTarFile(p, m, func(hdr *tar.Header, offset int64, r io.Reader) error {
+		return handleEntry(p, hdr.Name, offset, r, h)
+	})
+}
+
+// entryHandler is like handler, but receives the header of the entry instead
+// of its name.
+type entryHandler func(hdr *tar.Header, r io.Reader) error
+
+// forEachMatchingEntryHeader is like forEachMatchingEntry, but passes the
+// header of the entries to 'h'. The size in the header is the size of the
+// entry as stored in the TAR file, and can be used without reading the content.
+func forEachMatchingEntryHeader(p string, m matcher, h entryHandler) error {
+	return walkTarFile(p, m, func(hdr *tar.Header, offset int64, r io.Reader) error {
+		return handleEntry(p, hdr.Name, offset, r, func(_ string, r io.Reader) error {
+			return h(hdr, r)
+		})
+	})
+}
+
 func forEachEntry(p string, h handler) error {
 	return forEachMatchingEntry(p, any, h)
 }
@@ -51,3 +340,76 @@ func onMatchingEntry(p string, m matcher, h handler) error {
 		return errStop
 	})
 }
+
+// forEachMatchingEntryConcurrently is like forEachMatchingEntry, but processes
+// up to 'jobs' entries concurrently. Every entry is processed by a new handler
+// returned by 'newHandler', writing to a private buffer. The buffers are
+// written to 'w' in the same order as the entries, so the output is the same
+// as processing the entries sequentially. Once an entry fails, or its handler
+// returns errStop, no more entries are dispatched and the output of the entries
+// following it is discarded.
+func forEachMatchingEntryConcurrently(p string, m matcher, jobs int, newHandler func(w io.Writer) handler, w io.Writer) error {
+	if jobs <= 1 {
+		return forEachMatchingEntry(p, m, newHandler(w))
+	}
+
+	type result struct {
+		out bytes.Buffer
+		err error
+	}
+
+	var (
+		pending = make(chan chan *result, jobs)
+		stopped = make(chan struct{})
+		flushed = make(chan error, 1)
+	)
+
+	go func() {
+		var err error
+		for c := range pending {
+			res := <-c
+			if err != nil {
+				continue
+			}
+			if _, err = res.out.WriteTo(w); err == nil {
+				err = res.err
+			}
+			if err != nil {
+				close(stopped)
+			}
+		}
+		if err == errStop {
+			err = nil
+		}
+		flushed <- err
+	}()
+
+	err := walkTarFile(p, m, func(hdr *tar.Header, offset int64, r io.Reader) error {
+		select {
+		case <-stopped:
+			return errStop
+		default:
+		}
+		n := hdr.Name
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return entryPolicy.onEntryError(p, n, offset+int64(len(data)), &inspect.ParseError{Err: err})
+		}
+		c := make(chan *result, 1)
+		pending <- c
+		go func() {
+			var res result
+			res.err = handleEntry(p, n, offset, bytes.NewReader(data), newHandler(&res.out))
+			c <- &res
+		}()
+		return nil
+	})
+
+	close(pending)
+
+	if ferr := <-flushed; ferr != nil {
+		return ferr
+	}
+
+	return err
+}
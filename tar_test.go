@@ -0,0 +1,288 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
+)
+
+func TestErrorPolicy(t *testing.T) {
+	parseIndex := func(_ string, r io.Reader) error {
+		var idx index.Index
+		_, err := inspect.Parse(idx.ReadFrom, r)
+		return err
+	}
+	tests := []struct {
+		name     string
+		strict   bool
+		h        handler
+		wantErr  bool
+		wantSkip int
+	}{
+		{"lenient", false, parseIndex, false, 1},
+		{"strict", true, parseIndex, true, 0},
+		{"required", false, requiring(parseIndex), true, 0},
+		{"required strict", true, requiring(parseIndex), true, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := writeTestTar(t, "data00000a.tar", corrupt(testIndex("data00000a.tar", testStore()...)))
+			var (
+				err     error
+				skipped int
+			)
+			warnings := withPolicy(t, test.strict, func() {
+				err = forEachMatchingEntry(p, isIndex, test.h)
+				skipped = entryPolicy.skippedEntries()
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			var parseErr *inspect.ParseError
+			if err != nil && !errors.As(err, &parseErr) {
+				t.Fatalf("got error %v, want a parse error", err)
+			}
+			if skipped != test.wantSkip {
+				t.Fatalf("got %d skipped entries, want %d", skipped, test.wantSkip)
+			}
+			if got := strings.Count(warnings, "Warning:"); got != test.wantSkip {
+				t.Fatalf("got %d warnings, want %d: %q", got, test.wantSkip, warnings)
+			}
+		})
+	}
+}
+
+func TestUnknownEntry(t *testing.T) {
+	p := writeTestTar(t, "data00000a.tar", testEntry{"unknown", []byte("data")})
+	warnings := withPolicy(t, false, func() {
+		if err := forEachEntry(p, func(string, io.Reader) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if n := entryPolicy.skippedEntries(); n != 1 {
+			t.Fatalf("got %d skipped entries, want 1", n)
+		}
+	})
+	if !strings.Contains(warnings, "unknown entry") {
+		t.Fatalf("unexpected warnings %q", warnings)
+	}
+}
+
+func TestRequiredIndexIsNotEmpty(t *testing.T) {
+	p := writeTestTar(t, "data00000a.tar", corrupt(testIndex("data00000a.tar", testStore()...)))
+	withPolicy(t, false, func() {
+		if _, err := readIndex(p); err == nil {
+			t.Fatal("a corrupted index was read as empty")
+		}
+	})
+}
+
+func TestEntryTooLarge(t *testing.T) {
+	hdr := &tar.Header{Name: "data00000a.tar.idx", Size: maxEntrySize + 1}
+	_, err := ioutil.ReadAll(entryContent(hdr, strings.NewReader("")))
+	if err == nil || !strings.Contains(err.Error(), "entry too large") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestGraphSizeLargerThanEntry(t *testing.T) {
+	g := testGraph("data00000a.tar", testStore()...)
+	data := append([]byte(nil), g.data...)
+	binary.BigEndian.PutUint32(data[len(data)-8:], uint32(len(data)+1))
+	p := writeTestTar(t, "data00000a.tar", testEntry{g.name, data})
+	withPolicy(t, true, func() {
+		err := forEachMatchingEntry(p, isGraph, inspect.PrintGraph(inspect.FormatText, inspect.AnyID, inspect.AllEntries(), inspect.Notation{}, ioutil.Discard))
+		var parseErr *inspect.ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("got error %v, want a parse error", err)
+		}
+	})
+}
+
+func TestTruncatedGraphNamesEntry(t *testing.T) {
+	g := testGraph("data00000a.tar", testStore()...)
+	p := writeTestTar(t, "data00000a.tar", testEntry{g.name, g.data[:len(g.data)-1]})
+	h := inspect.PrintGraph(inspect.FormatText, inspect.AnyID, inspect.AllEntries(), inspect.Notation{}, ioutil.Discard)
+	for _, strict := range []bool{false, true} {
+		var err error
+		warnings := withPolicy(t, strict, func() {
+			err = forEachMatchingEntry(p, isGraph, h)
+		})
+		msg := warnings
+		if strict {
+			if err == nil {
+				t.Fatal("a truncated graph was read successfully")
+			}
+			msg = err.Error()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(msg, "data00000a.tar.gph") {
+			t.Fatalf("strict %v: %q doesn't name the entry", strict, msg)
+		}
+	}
+}
+
+func TestEntryContentDecompression(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte("content"))
+	zw.Close()
+	var (
+		data = testSegment{id: testA}.entry().name
+		bulk = testSegment{id: testC}.entry().name
+	)
+	tests := []struct {
+		name       string
+		decompress bool
+	}{
+		{data, true},
+		{bulk, false},
+		{"data00000a.tar.idx", true},
+		{"data00000a.tar.gph", true},
+		{"data00000a.tar.brf", true},
+		{"unknown", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hdr := &tar.Header{Name: test.name, Size: int64(compressed.Len())}
+			got, err := ioutil.ReadAll(entryContent(hdr, bytes.NewReader(compressed.Bytes())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := compressed.Bytes()
+			if test.decompress {
+				want = []byte("content")
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestBulkSegmentStartingWithGzipMagic(t *testing.T) {
+	var (
+		content = append([]byte{0x1f, 0x8b}, bytes.Repeat([]byte{0xab}, 62)...)
+		name    = fmt.Sprintf("%s.%08x", testC.uuid(), crc32.ChecksumIEEE(content))
+		p       = writeTestTar(t, "data00000a.tar", testEntry{name, content})
+		got     []byte
+	)
+	err := forEachMatchingEntry(p, isAnySegment, func(_ string, r io.Reader) error {
+		var err error
+		got, err = ioutil.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("got %x, want %x", got, content)
+	}
+}
+
+// benchmarkTar writes a TAR file of about 100 MB of bulk segments.
+func benchmarkTar(b *testing.B) string {
+	var (
+		content = bytes.Repeat([]byte{0xab}, 256*1024)
+		name    = fmt.Sprintf("%s.%08x", testC.uuid(), crc32.ChecksumIEEE(content))
+		entries = make([]testEntry, 400)
+	)
+	for i := range entries {
+		entries[i] = testEntry{name, content}
+	}
+	return writeTestTar(b, "data00000a.tar", entries...)
+}
+
+// BenchmarkForEachEntry compares the allocations of a handler streaming the
+// content of the entries with the ones of a handler buffering it.
+func BenchmarkForEachEntry(b *testing.B) {
+	p := benchmarkTar(b)
+	handlers := []struct {
+		name string
+		h    handler
+	}{
+		{"streaming", func(_ string, r io.Reader) error {
+			_, err := io.Copy(ioutil.Discard, r)
+			return err
+		}},
+		{"buffering", func(_ string, r io.Reader) error {
+			_, err := ioutil.ReadAll(r)
+			return err
+		}},
+	}
+	for _, h := range handlers {
+		b.Run(h.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := forEachMatchingEntry(p, isAnySegment, h.h); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedIndex(t *testing.T) {
+	idx := testIndex("data00000a.tar", testStore()...)
+	printIndex := func(e testEntry) string {
+		var b bytes.Buffer
+		p := writeTestTar(t, "data00000a.tar", e)
+		h := inspect.PrintIndex(inspect.FormatText, inspect.IndexView{Keep: inspect.AllOf(), Page: inspect.AllEntries()}, &b)
+		if err := forEachMatchingEntry(p, isIndex, h); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	want, got := printIndex(idx), printIndex(compressed(idx))
+	if want == "" || got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	var (
+		plain   = testIndex("data00000a.tar", testStore()...).data
+		gzipped = compressed(testEntry{data: plain}).data
+	)
+	tests := []struct {
+		name           string
+		autoDecompress bool
+		data           []byte
+		want           []byte
+	}{
+		{"plain", true, plain, plain},
+		{"compressed", true, gzipped, plain},
+		{"plain without decompression", false, plain, plain},
+		{"compressed without decompression", false, gzipped, gzipped},
+		{"shorter than the magic", true, []byte{0x1f}, []byte{0x1f}},
+		{"empty", true, nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func(old bool) { autoDecompress = old }(autoDecompress)
+			autoDecompress = test.autoDecompress
+			r, err := decompress(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Fatalf("got %x, want %x", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/francescomari/sdb/index"
+	"github.com/francescomari/sdb/inspect"
+)
+
+// tarSummary describes a TAR file of a segment store. The segments and their
+// generations are read from the index. If the TAR file doesn't have an index,
+// the segment entries are counted instead and the generations are unknown.
+type tarSummary struct {
+	size        int64
+	segments    int
+	generations map[int]bool
+	index       bool
+	graph       bool
+	binaries    bool
+}
+
+func newTarSummary() *tarSummary {
+	return &tarSummary{generations: make(map[int]bool)}
+}
+
+// summarizeTarFile reads the summary of the TAR file at 'p'. Only the index is
+// parsed, the content of the other entries is skipped. A corrupted index is an
+// error, since the segment entries would otherwise be counted instead.
+func summarizeTarFile(p string) (*tarSummary, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		s       = newTarSummary()
+		entries int
+	)
+	s.size = info.Size()
+	err = forEachEntry(p, requiring(func(n string, r io.Reader) error {
+		switch {
+		case isIndex(n):
+			var idx index.Index
+			if _, err := inspect.Parse(idx.ReadFrom, r); err != nil {
+				return err
+			}
+			s.index = true
+			s.segments = len(idx.Entries)
+			for _, e := range idx.Entries {
+				s.generations[e.Generation] = true
+			}
+		case isGraph(n):
+			s.graph = true
+		case isBinary(n):
+			s.binaries = true
+		case isAnySegment(n):
+			entries++
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if !s.index {
+		s.segments = entries
+	}
+	return s, nil
+}
+
+// newTotalTarSummary returns a summary that can be used to sum the summaries of
+// several TAR files. The total has an index, a graph or an index of binary
+// references only if every TAR file has one.
+func newTotalTarSummary() *tarSummary {
+	s := newTarSummary()
+	s.index = true
+	s.graph = true
+	s.binaries = true
+	return s
+}
+
+func (s *tarSummary) add(o *tarSummary) {
+	s.size += o.size
+	s.segments += o.segments
+	for g := range o.generations {
+		s.generations[g] = true
+	}
+	s.index = s.index && o.index
+	s.graph = s.graph && o.graph
+	s.binaries = s.binaries && o.binaries
+}
+
+// summarizeTarFiles reads the summaries of the TAR files at 'paths', using up
+// to 'jobs' goroutines. The summaries and the errors are returned in the same
+// order as the paths. Exactly one of the summary and the error of a TAR file is
+// not nil.
+func summarizeTarFiles(paths []string, jobs int) ([]*tarSummary, []error) {
+	var (
+		summaries = make([]*tarSummary, len(paths))
+		errs      = make([]error, len(paths))
+		next      = make(chan int)
+		wg        sync.WaitGroup
+	)
+	if jobs < 1 {
+		jobs = 1
+	}
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				summaries[i], errs[i] = summarizeTarFile(paths[i])
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return summaries, errs
+}
+
+// printTarSummary prints the summary of a TAR file. The number of generations
+// and the minimum and maximum generation are printed as '-' if they are
+// unknown. The size is printed in binary multiples if 'human' is true.
+func printTarSummary(name string, s *tarSummary, human bool, w io.Writer) {
+	var (
+		generations = "-"
+		min         = "-"
+		max         = "-"
+	)
+	if len(s.generations) > 0 {
+		var gs []int
+		for g := range s.generations {
+			gs = append(gs, g)
+		}
+		sort.Ints(gs)
+		generations = strconv.Itoa(len(gs))
+		min = strconv.Itoa(gs[0])
+		max = strconv.Itoa(gs[len(gs)-1])
+	}
+	fmt.Fprintf(w, "size %s segments %d generations %s index %v graph %v binaries %v minGeneration %s maxGeneration %s %s\n", formatSize(int(s.size), human), s.segments, generations, s.index, s.graph, s.binaries, min, max, name)
+}
+
+// printTarSummaries prints the summary of every TAR file in 'directory',
+// followed by the totals if there is more than one TAR file. TAR files that
+// can't be read are printed as an ERR row, and the error is reported on
+// standard error. It returns false if any TAR file can't be read.
+func printTarSummaries(directory string, all bool, jobs int, human bool, w io.Writer) (bool, error) {
+	var names []string
+	err := forEachTarFile(directory, all, func(name string) {
+		names = append(names, name)
+	})
+	if err != nil {
+		return false, err
+	}
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(directory, name)
+	}
+	var (
+		summaries, errs = summarizeTarFiles(paths, jobs)
+		total           = newTotalTarSummary()
+		files           int
+		ok              = true
+	)
+	for i, name := range names {
+		if errs[i] != nil {
+			fmt.Fprintf(w, "ERR %s\n", name)
+			fmt.Fprintf(os.Stderr, "Unable to summarize TAR file: %s: %v.\n", paths[i], errs[i])
+			ok = false
+			continue
+		}
+		printTarSummary(name, summaries[i], human, w)
+		total.add(summaries[i])
+		files++
+	}
+	if files > 1 {
+		printTarSummary("total", total, human, w)
+	}
+	return ok, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrintTarSummaries(t *testing.T) {
+	var (
+		segments = testStore()
+		dir      = t.TempDir()
+		files    = map[string][]testEntry{
+			"data00000a.tar": testStoreEntries("data00000a.tar"),
+			"data00001a.tar": {segments[0].entry(), segments[1].entry()},
+			"data00002a.tar": {segments[0].entry(), corrupt(testIndex("data00002a.tar", segments[0]))},
+		}
+	)
+	for name, entries := range files {
+		data, err := ioutil.ReadFile(writeTestTar(t, name, entries...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var (
+		b   bytes.Buffer
+		ok  bool
+		err error
+	)
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+	withPolicy(t, false, func() {
+		ok, err = printTarSummaries(dir, false, 2, false, &b)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("a TAR file with a corrupted index was summarized")
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	want := []string{
+		"segments 4 generations 3 index true graph true binaries false minGeneration 1 maxGeneration 3 data00000a.tar",
+		"segments 2 generations - index false graph false binaries false minGeneration - maxGeneration - data00001a.tar",
+		"ERR data00002a.tar",
+		"segments 6 generations 3 index false graph false binaries false minGeneration 1 maxGeneration 3 total",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %q, want %d lines", lines, len(want))
+	}
+	for i := range want {
+		if !strings.HasSuffix(lines[i], want[i]) {
+			t.Fatalf("line %d: got %q, want suffix %q", i, lines[i], want[i])
+		}
+	}
+}